@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/negotiator"
+)
+
+var addrFlag = flag.String("addr", "0.0.0.0:8080", "a comma separated list of addresses to listen on, e.g. 0.0.0.0:8080,[::]:8080")
+var altAddrFlag = flag.String("alt-addr", "", "comma separated addresses to also listen on and advertise for NAT discovery, "+
+	"ideally another ip and another port of this host, e.g. 203.0.113.5:8081,203.0.113.6:8080")
+var relaySessionsFlag = flag.Int("relay-sessions", 0, "how many pairs of peers that cannot punch through may be relayed at once, 0 disables relaying")
+var relayBandwidthFlag = flag.Int64("relay-bandwidth", 0, "the bytes per second relayed in each direction of a pair, 0 is unlimited")
+var heartbeatTimeoutFlag = flag.Duration("heartbeat-timeout", time.Minute, "close peer connections silent for longer, 0 never closes them")
+var offerTimeoutFlag = flag.Duration("offer-timeout", 30*time.Second, "how long peers screening connections may take to accept one")
+var maxIntroductionsFlag = flag.Int("max-introductions", 16, "how many connection requests of a peer may be in progress at once")
+var relayWaitFlag = flag.Duration("relay-wait", 30*time.Second, "how long a relay request waits for the other peer")
+var duplicatePolicyFlag = flag.String("duplicate-policy", "reject",
+	"what to do when a peer registers a taken name: reject, replace (if the owner is dead) or token (if it presents the owner's session token)")
+var authFileFlag = flag.String("auth-file", "", "a file of peer names and their credentials, registration is open when empty")
+var aclFileFlag = flag.String("acl-file", "", "a file of rules deciding which peers may connect to which, all connections are allowed when empty")
+var tlsCertFlag = flag.String("tls-cert", "", "a PEM certificate to serve TLS with, requires --tls-key")
+var tlsKeyFlag = flag.String("tls-key", "", "the PEM private key of --tls-cert")
+var tlsClientCAFlag = flag.String("tls-client-ca", "", "a PEM file of CAs peers must present a client certificate from (mTLS)")
+
+func main() {
+	flag.Parse()
+	addrs := strings.Split(*addrFlag, ",")
+	var altAddrs []string
+	if *altAddrFlag != "" {
+		altAddrs = strings.Split(*altAddrFlag, ",")
+	}
+	policy, err := negotiator.ParseDuplicatePolicy(*duplicatePolicyFlag)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("starting server on %v...\n", strings.Join(append(addrs, altAddrs...), ", "))
+
+	listeners := make([]net.Listener, len(addrs)+len(altAddrs))
+	for i, addr := range append(addrs, altAddrs...) {
+		listeners[i], err = net.Listen("tcp", addr)
+		if err != nil {
+			panic(fmt.Errorf("failed to start server, err: %v", err))
+		}
+	}
+
+	srv := negotiator.NewServer(negotiator.NewMemoryRegistry())
+	srv.Log = log.New(os.Stdout, "", 0)
+	srv.DuplicatePolicy = policy
+	srv.MaxRelaySessions = *relaySessionsFlag
+	srv.RelayBandwidth = *relayBandwidthFlag
+	srv.RelayWaitTimeout = *relayWaitFlag
+	srv.HeartbeatTimeout = *heartbeatTimeoutFlag
+	srv.OfferTimeout = *offerTimeoutFlag
+	srv.MaxIntroductions = *maxIntroductionsFlag
+	for _, addr := range altAddrs {
+		sa, err := helpers.StrToSockaddr(addr)
+		if err != nil {
+			panic(fmt.Errorf("failed to parse alternate address, err: %v", err))
+		}
+		srv.AlternateAddrs = append(srv.AlternateAddrs, sa)
+	}
+	if *tlsCertFlag != "" || *tlsKeyFlag != "" {
+		srv.TLSConfig, err = loadTLSConfig()
+		if err != nil {
+			panic(fmt.Errorf("failed to load tls configuration, err: %v", err))
+		}
+	}
+	if *authFileFlag != "" {
+		auth, err := negotiator.LoadAuthFile(*authFileFlag)
+		if err != nil {
+			panic(fmt.Errorf("failed to load auth file, err: %v", err))
+		}
+		srv.Authenticator = auth
+	}
+	if *aclFileFlag != "" {
+		acl, err := negotiator.LoadACLFile(*aclFileFlag)
+		if err != nil {
+			panic(fmt.Errorf("failed to load acl file, err: %v", err))
+		}
+		srv.ACL = acl
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		fmt.Println("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- srv.Serve(l)
+		}(l)
+	}
+	for range listeners {
+		if err := <-errs; err != negotiator.ErrServerClosed {
+			panic(fmt.Errorf("server stopped, err: %v", err))
+		}
+	}
+}
+
+func loadTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(*tlsCertFlag, *tlsKeyFlag)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if *tlsClientCAFlag != "" {
+		pool, err := helpers.LoadCertPool(*tlsClientCAFlag)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
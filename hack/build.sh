@@ -3,5 +3,5 @@
 go build -v -o ./peer/peer ./peer/.
 
 # build negotiator
-go build -v -o ./negotiator/negotiator ./negotiator/.
+go build -v -o ./cmd/negotiator/negotiator ./cmd/negotiator/.
 
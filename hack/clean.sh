@@ -1,3 +1,3 @@
 rm peer/peer
-rm negotiator/negotiator
+rm cmd/negotiator/negotiator
 rm -rf types/*
\ No newline at end of file
@@ -0,0 +1,73 @@
+#!/bin/bash
+# builds a NAT test lab out of network namespaces, run as root:
+#
+#   ./hack/nat-lab.sh up [cone|symmetric]   create the lab
+#   ./hack/nat-lab.sh down                  remove it
+#
+# the negotiator namespace has 10.0.0.1 and 10.0.0.2 on the public segment,
+# peer-a (192.168.1.2) and peer-b (192.168.2.2) sit behind nat-a (10.0.0.10) and nat-b (10.0.0.20):
+#
+#   ip netns exec negotiator ./cmd/negotiator/negotiator --addr 10.0.0.1:8080 --alt-addr 10.0.0.1:8081,10.0.0.2:8080
+#   ip netns exec peer-a ./peer/peer --negotiator-addr 10.0.0.1:8080 --name alice --detect-nat
+#   ip netns exec peer-b ./peer/peer --negotiator-addr 10.0.0.1:8080 --name bob --target alice --detect-nat
+set -e
+
+NSS="wan negotiator nat-a nat-b peer-a peer-b"
+
+down() {
+    for ns in $NSS; do
+        ip netns del "$ns" 2>/dev/null || true
+    done
+}
+
+# link <ns1> <if1> <ns2> <if2>
+link() {
+    ip link add "$2" netns "$1" type veth peer name "$4" netns "$3"
+    ip -n "$1" link set "$2" up
+    ip -n "$3" link set "$4" up
+}
+
+# nat <name> <public ip> <private subnet> <mode>
+nat() {
+    link wan "wan-$1" "nat-$1" wan0
+    ip -n wan link set "wan-$1" master br0
+    ip -n "nat-$1" addr add "$2/24" dev wan0
+    link "nat-$1" lan0 "peer-$1" eth0
+    ip -n "nat-$1" addr add "$3.1/24" dev lan0
+    ip -n "peer-$1" addr add "$3.2/24" dev eth0
+    ip -n "peer-$1" route add default via "$3.1"
+    ip netns exec "nat-$1" sysctl -qw net.ipv4.ip_forward=1
+
+    local random=""
+    if [ "$4" == "symmetric" ]; then
+        random="--random-fully"
+    fi
+    ip netns exec "nat-$1" iptables -t nat -A POSTROUTING -o wan0 -j MASQUERADE $random
+    # only let in what belongs to connections the peer started
+    ip netns exec "nat-$1" iptables -A FORWARD -i wan0 -m conntrack ! --ctstate ESTABLISHED,RELATED -j DROP
+}
+
+up() {
+    down
+    for ns in $NSS; do
+        ip netns add "$ns"
+        ip -n "$ns" link set lo up
+    done
+
+    ip -n wan link add br0 type bridge
+    ip -n wan link set br0 up
+
+    link wan wan-neg negotiator wan0
+    ip -n wan link set wan-neg master br0
+    ip -n negotiator addr add 10.0.0.1/24 dev wan0
+    ip -n negotiator addr add 10.0.0.2/24 dev wan0
+
+    nat a 10.0.0.10 192.168.1 "$1"
+    nat b 10.0.0.20 192.168.2 "$1"
+}
+
+case "$1" in
+up) up "${2:-cone}" ;;
+down) down ;;
+*) echo "usage: $0 up [cone|symmetric] | down" && exit 1 ;;
+esac
@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"sort"
+	"syscall"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+	fb "github.com/google/flatbuffers/go"
+)
+
+// MaxCandidates is the most candidates a registration or peer may carry
+const MaxCandidates = 32
+
+// Candidate is an address a peer may be reachable at, higher priorities are tried first
+type Candidate struct {
+	Type     peer.CandidateType
+	Addr     syscall.Sockaddr
+	Priority int32
+}
+
+var typePreference = map[peer.CandidateType]int32{
+	peer.CandidateTypeHost:            126,
+	peer.CandidateTypeServerReflexive: 100,
+	peer.CandidateTypeRelay:           0,
+}
+
+// CandidatePriority ranks candidates by type first and by localPref (0-65535) within a type
+func CandidatePriority(typ peer.CandidateType, localPref int) int32 {
+	return typePreference[typ]<<16 | int32(localPref&0xffff)
+}
+
+// SortCandidates returns the candidates ordered by descending priority without repeated addresses,
+// an address keeps its highest priority and cands itself is left as it was
+func SortCandidates(cands []Candidate) []Candidate {
+	sorted := append([]Candidate(nil), cands...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	seen := map[string]bool{}
+	res := sorted[:0]
+	for _, c := range sorted {
+		if c.Addr == nil || seen[SockaddrToStr(c.Addr)] {
+			continue
+		}
+		seen[SockaddrToStr(c.Addr)] = true
+		res = append(res, c)
+	}
+	return res
+}
+
+func addReqCandidates(b *fb.Builder, cands []Candidate) fb.UOffsetT {
+	offsets := make([]fb.UOffsetT, len(cands))
+	for i, c := range cands {
+		addr := addReqAddr(b, c.Addr)
+		request.CandidateStart(b)
+		request.CandidateAddType(b, request.CandidateType(c.Type))
+		request.CandidateAddAddr(b, addr)
+		request.CandidateAddPriority(b, c.Priority)
+		offsets[i] = request.CandidateEnd(b)
+	}
+
+	request.RegistrationRequestStartCandidatesVector(b, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	return b.EndVector(len(offsets))
+}
+
+func addPeerCandidates(b *fb.Builder, cands []Candidate) fb.UOffsetT {
+	offsets := make([]fb.UOffsetT, len(cands))
+	for i, c := range cands {
+		addr := addAddr(b, c.Addr)
+		peer.CandidateStart(b)
+		peer.CandidateAddType(b, c.Type)
+		peer.CandidateAddAddr(b, addr)
+		peer.CandidateAddPriority(b, c.Priority)
+		offsets[i] = peer.CandidateEnd(b)
+	}
+
+	peer.PeerStartCandidatesVector(b, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	return b.EndVector(len(offsets))
+}
+
+// ReqCandidates returns the candidates of a verified registration request
+func ReqCandidates(r *request.RegistrationRequest) []Candidate {
+	var cands []Candidate
+	c := &request.Candidate{}
+	for i := 0; i < r.CandidatesLength(); i++ {
+		if !r.Candidates(c, i) {
+			continue
+		}
+		addr := c.Addr(&request.Addr{})
+		if addr == nil {
+			continue
+		}
+		cands = append(cands, Candidate{
+			Type:     peer.CandidateType(c.Type()),
+			Addr:     ReqAddrToSockaddr(addr),
+			Priority: c.Priority(),
+		})
+	}
+	return cands
+}
+
+// PeerCandidates returns the candidates of p in priority order, for negotiators that do not
+// send candidates it falls back to the local address and the address the negotiator observed
+func PeerCandidates(p *peer.Peer) []Candidate {
+	var cands []Candidate
+	c := &peer.Candidate{}
+	for i := 0; i < p.CandidatesLength(); i++ {
+		if !p.Candidates(c, i) {
+			continue
+		}
+		addr := c.Addr(&peer.Addr{})
+		if addr == nil {
+			continue
+		}
+		if sa := PeerAddrToSockaddr(addr); sa != nil {
+			cands = append(cands, Candidate{Type: c.Type(), Addr: sa, Priority: c.Priority()})
+		}
+	}
+
+	if len(cands) == 0 {
+		if la := p.LocalAddr(&peer.Addr{}); la != nil {
+			cands = append(cands, Candidate{
+				Type:     peer.CandidateTypeHost,
+				Addr:     PeerAddrToSockaddr(la),
+				Priority: CandidatePriority(peer.CandidateTypeHost, 0),
+			})
+		}
+		if ra := p.RemoteAddr(&peer.Addr{}); ra != nil {
+			cands = append(cands, Candidate{
+				Type:     peer.CandidateTypeServerReflexive,
+				Addr:     PeerAddrToSockaddr(ra),
+				Priority: CandidatePriority(peer.CandidateTypeServerReflexive, 0),
+			})
+		}
+	}
+	return SortCandidates(cands)
+}
@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+func candidate(typ peer.CandidateType, addr string, pref int) Candidate {
+	host, port, _ := net.SplitHostPort(addr)
+	var p int
+	fmt.Sscan(port, &p)
+	return Candidate{Type: typ, Addr: IPToSockaddr(net.ParseIP(host), p), Priority: CandidatePriority(typ, pref)}
+}
+
+func candidateAddrs(cands []Candidate) string {
+	var addrs []string
+	for _, c := range cands {
+		addrs = append(addrs, SockaddrToStr(c.Addr))
+	}
+	return fmt.Sprint(addrs)
+}
+
+func TestCandidatePriority(t *testing.T) {
+	host := CandidatePriority(peer.CandidateTypeHost, 0)
+	srflx := CandidatePriority(peer.CandidateTypeServerReflexive, 0xffff)
+	relay := CandidatePriority(peer.CandidateTypeRelay, 0xffff)
+	if !(host > srflx && srflx > relay) {
+		t.Fatalf("expected host > server reflexive > relay whatever the local preference, got: %v %v %v", host, srflx, relay)
+	}
+	if CandidatePriority(peer.CandidateTypeHost, 2) <= CandidatePriority(peer.CandidateTypeHost, 1) {
+		t.Fatalf("expected a higher local preference to rank higher")
+	}
+}
+
+func TestSortCandidates(t *testing.T) {
+	mapped := &syscall.SockaddrInet6{Port: 4000}
+	copy(mapped.Addr[:], net.ParseIP("::ffff:10.0.0.1"))
+
+	cases := []struct {
+		name  string
+		cands []Candidate
+		want  string
+	}{
+		{"empty", nil, "[]"},
+		{
+			name: "by type and preference",
+			cands: []Candidate{
+				candidate(peer.CandidateTypeRelay, "9.9.9.9:1", 0xffff),
+				candidate(peer.CandidateTypeServerReflexive, "1.2.3.4:4000", 0),
+				candidate(peer.CandidateTypeHost, "10.0.0.1:4000", 1),
+				candidate(peer.CandidateTypeHost, "10.0.0.2:4000", 2),
+			},
+			want: "[10.0.0.2:4000 10.0.0.1:4000 1.2.3.4:4000 9.9.9.9:1]",
+		},
+		{
+			name: "equal priorities keep their order",
+			cands: []Candidate{
+				candidate(peer.CandidateTypeHost, "10.0.0.3:4000", 0),
+				candidate(peer.CandidateTypeHost, "10.0.0.1:4000", 0),
+				candidate(peer.CandidateTypeHost, "10.0.0.2:4000", 0),
+			},
+			want: "[10.0.0.3:4000 10.0.0.1:4000 10.0.0.2:4000]",
+		},
+		{
+			name: "a repeated address keeps its highest priority",
+			cands: []Candidate{
+				candidate(peer.CandidateTypeServerReflexive, "10.0.0.1:4000", 0),
+				candidate(peer.CandidateTypeHost, "10.0.0.2:4000", 0),
+				candidate(peer.CandidateTypeHost, "10.0.0.1:4000", 5),
+			},
+			want: "[10.0.0.1:4000 10.0.0.2:4000]",
+		},
+		{
+			name: "mapped IPv4 repeats IPv4",
+			cands: []Candidate{
+				candidate(peer.CandidateTypeHost, "10.0.0.1:4000", 0),
+				{Type: peer.CandidateTypeHost, Addr: mapped, Priority: CandidatePriority(peer.CandidateTypeHost, 1)},
+			},
+			want: "[10.0.0.1:4000]",
+		},
+		{
+			name: "same ip on other ports",
+			cands: []Candidate{
+				candidate(peer.CandidateTypeHost, "10.0.0.1:4000", 0),
+				candidate(peer.CandidateTypeHost, "10.0.0.1:4001", 0),
+			},
+			want: "[10.0.0.1:4000 10.0.0.1:4001]",
+		},
+		{
+			name: "no address",
+			cands: []Candidate{
+				{Type: peer.CandidateTypeHost, Priority: CandidatePriority(peer.CandidateTypeHost, 0xffff)},
+				candidate(peer.CandidateTypeHost, "10.0.0.1:4000", 0),
+			},
+			want: "[10.0.0.1:4000]",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := candidateAddrs(tc.cands)
+			expect(t, candidateAddrs(SortCandidates(tc.cands)), tc.want)
+			if after := candidateAddrs(tc.cands); after != before {
+				t.Fatalf("expected the candidates passed in to be left as they were, got: %v", after)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/types/request"
+	fb "github.com/google/flatbuffers/go"
+)
+
+// Credential proves a peer may register the name it asks for,
+// either a bearer token or an HMAC over the name, a nonce and a timestamp
+type Credential struct {
+	Type      request.CredentialType
+	Token     string
+	Nonce     []byte
+	Timestamp int64
+	MAC       []byte
+}
+
+// RegistrationMAC computes the HMAC-SHA256 a peer signs its registration with, it covers the
+// identity key so whoever relays the registration cannot swap in a key of their own
+func RegistrationMAC(secret []byte, name string, identityKey, nonce []byte, timestamp int64) []byte {
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(timestamp))
+
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(name))
+	m.Write([]byte{0})
+	m.Write([]byte{byte(len(identityKey))})
+	m.Write(identityKey)
+	m.Write(nonce)
+	m.Write(ts)
+	return m.Sum(nil)
+}
+
+func NewTokenCredential(token string) *Credential {
+	return &Credential{Type: request.CredentialTypeToken, Token: token}
+}
+
+// NewHMACCredential signs name and the identity key registered with it with secret using a fresh
+// nonce and the current time
+func NewHMACCredential(secret []byte, name string, identityKey []byte) (*Credential, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ts := time.Now().Unix()
+	return &Credential{
+		Type:      request.CredentialTypeHMAC,
+		Nonce:     nonce,
+		Timestamp: ts,
+		MAC:       RegistrationMAC(secret, name, identityKey, nonce, ts),
+	}, nil
+}
+
+// ReqCredential copies the credential out of a registration request, it returns nil if there is none
+func ReqCredential(c *request.Credential) *Credential {
+	if c == nil {
+		return nil
+	}
+	return &Credential{
+		Type:      c.Type(),
+		Token:     string(c.Token()),
+		Nonce:     append([]byte{}, c.NonceBytes()...),
+		Timestamp: c.Timestamp(),
+		MAC:       append([]byte{}, c.MacBytes()...),
+	}
+}
+
+func addCredential(b *fb.Builder, c *Credential) fb.UOffsetT {
+	token := b.CreateString(c.Token)
+	nonce := b.CreateByteVector(c.Nonce)
+	mac := b.CreateByteVector(c.MAC)
+
+	request.CredentialStart(b)
+	request.CredentialAddType(b, c.Type)
+	request.CredentialAddToken(b, token)
+	request.CredentialAddNonce(b, nonce)
+	request.CredentialAddTimestamp(b, c.Timestamp)
+	request.CredentialAddMac(b, mac)
+	return request.CredentialEnd(b)
+}
@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// MaxFrameSize is the default limit on the payload size of a single frame
+const MaxFrameSize = 64 * 1024
+
+const frameHeaderSize = 4
+
+var ErrFrameTooLarge = errors.New("frame exceeds the maximum frame size")
+
+// Framer sends and receives length prefixed messages over a stream,
+// every frame is a 4 byte big endian payload length followed by the payload
+type Framer struct {
+	// WriteTimeout bounds every write when the stream has write deadlines, such as a net.Conn,
+	// the framer is then the only one to set them, writes are unbounded when it is 0
+	WriteTimeout time.Duration
+
+	rw      io.ReadWriter
+	maxSize int
+	rmut    sync.Mutex
+	wmut    sync.Mutex
+}
+
+func NewFramer(rw io.ReadWriter) *Framer {
+	return NewFramerSize(rw, MaxFrameSize)
+}
+
+func NewFramerSize(rw io.ReadWriter, maxSize int) *Framer {
+	return &Framer{rw: rw, maxSize: maxSize}
+}
+
+func (f *Framer) WriteFrame(payload []byte) error {
+	if len(payload) > f.maxSize {
+		return fmt.Errorf("%w: size=%v max=%v", ErrFrameTooLarge, len(payload), f.maxSize)
+	}
+
+	// header and payload go out in a single write so concurrent writers
+	// can never interleave their frames
+	buf := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[frameHeaderSize:], payload)
+
+	f.wmut.Lock()
+	defer f.wmut.Unlock()
+	if dl, ok := f.rw.(interface{ SetWriteDeadline(time.Time) error }); ok && f.WriteTimeout > 0 {
+		dl.SetWriteDeadline(time.Now().Add(f.WriteTimeout))
+	}
+	if _, err := f.rw.Write(buf); err != nil {
+		// a frame cut short would have the other end misread every frame after it
+		if c, ok := f.rw.(io.Closer); ok {
+			c.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadFrame blocks until a complete frame has arrived and returns its payload,
+// the returned slice is never reused by the framer
+func (f *Framer) ReadFrame() ([]byte, error) {
+	f.rmut.Lock()
+	defer f.rmut.Unlock()
+
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(f.rw, header); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if uint64(size) > uint64(f.maxSize) {
+		return nil, fmt.Errorf("%w: size=%v max=%v", ErrFrameTooLarge, size, f.maxSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(f.rw, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,174 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFramerWriteTimeout(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	fr := NewFramer(local)
+	fr.WriteTimeout = 50 * time.Millisecond
+
+	// nothing reads the other end, the write gives up and closes the stream it may have cut short
+	err := fr.WriteFrame([]byte("stalled"))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+	remote.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := NewFramer(remote).ReadFrame(); err == nil {
+		t.Fatalf("expected the stream to be closed")
+	}
+}
+
+func TestFramerWriteTimeoutIsPerWrite(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	fr := NewFramer(local)
+	fr.WriteTimeout = 50 * time.Millisecond
+
+	go func() {
+		rf := NewFramer(remote)
+		for {
+			if _, err := rf.ReadFrame(); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		// an earlier write's deadline has long passed by the next one
+		time.Sleep(2 * fr.WriteTimeout)
+		if err := fr.WriteFrame([]byte("frame")); err != nil {
+			t.Fatalf("failed to write frame %v, err: %v", i, err)
+		}
+	}
+}
+
+// chunkedReader returns at most n bytes per read, as a stream split across several segments does
+type chunkedReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	return c.r.Read(p)
+}
+
+func (c *chunkedReader) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+// frames returns the bytes WriteFrame puts on the wire for every payload
+func frames(t *testing.T, payloads ...[]byte) []byte {
+	var buf bytes.Buffer
+	fr := NewFramer(&buf)
+	for _, p := range payloads {
+		if err := fr.WriteFrame(p); err != nil {
+			t.Fatalf("failed to write frame, err: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestFramerReadsSplitFrames(t *testing.T) {
+	payload := bytes.Repeat([]byte("split"), 1000)
+	for _, n := range []int{1, 3, 4, 5, 1000} {
+		fr := NewFramer(&chunkedReader{r: bytes.NewReader(frames(t, payload)), n: n})
+		got, err := fr.ReadFrame()
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Fatalf("reads of %v bytes: expected the payload back, got %v bytes, err: %v", n, len(got), err)
+		}
+	}
+}
+
+func TestFramerReadsCoalescedFrames(t *testing.T) {
+	payloads := [][]byte{[]byte("first"), {}, []byte("third"), bytes.Repeat([]byte{7}, 300)}
+	// every frame arrives in a single read
+	fr := NewFramer(bytes.NewBuffer(frames(t, payloads...)))
+	for i, want := range payloads {
+		got, err := fr.ReadFrame()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("frame %v: expected %q, got: %q, err: %v", i, want, got, err)
+		}
+	}
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Fatalf("expected %v after the last frame, got: %v", io.EOF, err)
+	}
+}
+
+func TestFramerFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	fr := NewFramerSize(&buf, 8)
+	if err := fr.WriteFrame(make([]byte, 9)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected %v on write, got: %v", ErrFrameTooLarge, err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %v bytes", buf.Len())
+	}
+	if err := fr.WriteFrame(make([]byte, 8)); err != nil {
+		t.Fatalf("failed to write a frame of the maximum size, err: %v", err)
+	}
+
+	// the header alone rejects a frame, its payload is never read
+	fr = NewFramerSize(bytes.NewBuffer(frames(t, make([]byte, 9))), 8)
+	if _, err := fr.ReadFrame(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected %v on read, got: %v", ErrFrameTooLarge, err)
+	}
+}
+
+func TestFramerTruncated(t *testing.T) {
+	whole := frames(t, []byte("truncated"))
+	cases := []struct {
+		name string
+		buf  []byte
+		err  error
+	}{
+		{"nothing", nil, io.EOF},
+		{"partial header", whole[:2], io.ErrUnexpectedEOF},
+		{"header only", whole[:frameHeaderSize], io.ErrUnexpectedEOF},
+		{"partial body", whole[:len(whole)-1], io.ErrUnexpectedEOF},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewFramer(bytes.NewBuffer(tc.buf)).ReadFrame(); err != tc.err {
+				t.Fatalf("expected %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestFramerConcurrentWritesDoNotInterleave(t *testing.T) {
+	var buf bytes.Buffer
+	fr := NewFramer(&buf)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fr.WriteFrame(bytes.Repeat([]byte{byte(i)}, 1000+i))
+		}(i)
+	}
+	wg.Wait()
+
+	rf := NewFramer(&buf)
+	for n := 0; n < 16; n++ {
+		got, err := rf.ReadFrame()
+		if err != nil {
+			t.Fatalf("failed to read frame, err: %v", err)
+		}
+		i := int(got[0])
+		if !bytes.Equal(got, bytes.Repeat([]byte{byte(i)}, 1000+i)) {
+			t.Fatalf("frame of writer %v is mixed with another", i)
+		}
+	}
+}
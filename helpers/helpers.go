@@ -2,9 +2,10 @@ package helpers
 
 import (
 	"fmt"
+	"net"
 	"strconv"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/arckey/tcp-punchthrough/types/peer"
 	"github.com/arckey/tcp-punchthrough/types/request"
@@ -19,77 +20,186 @@ func PanicIfErr(msg string, err error) {
 	panic(fmt.Errorf("%v, err: %v", msg, err))
 }
 
-func ConfigureSocket(sock int) error {
+// ConfigureSocket lets the socket share its local port with the other sockets of the peer
+func ConfigureSocket(fd uintptr) error {
 	for _, opt := range sockOpts {
-		if err := syscall.SetsockoptInt(sock, syscall.SOL_SOCKET, opt, 1); err != nil {
+		if err := setSockOpt(fd, opt); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func StrToAddrV4(addr string) (*syscall.SockaddrInet4, error) {
-	parts := strings.Split(addr, ":")
-	if len(parts) < 2 {
-		return nil, fmt.Errorf("malformed address: %v", addr)
+// ControlSocket is a net.Dialer and net.ListenConfig Control hook that applies ConfigureSocket
+func ControlSocket(network, address string, c syscall.RawConn) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = ConfigureSocket(fd)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// SetListenBacklog listens on the socket of l again, which changes the backlog of a listening socket
+func SetListenBacklog(l net.Listener, backlog int) error {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("listener has no socket")
 	}
-	ip, port := parts[0], parts[1]
-	portno, err := strconv.Atoi(port)
+	raw, err := sc.SyscallConn()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse address: %v, err: %v", addr, err)
+		return err
 	}
-	ipParts := strings.Split(ip, ".")
-	if len(ipParts) != 4 {
-		return nil, fmt.Errorf("malformed address: %v", addr)
+	if cerr := raw.Control(func(fd uintptr) {
+		err = listenBacklog(fd, backlog)
+	}); cerr != nil {
+		return cerr
 	}
+	return err
+}
 
-	p1, err := strconv.Atoi(ipParts[0])
+// StrToSockaddr resolves a host:port address, IPv6 hosts must be in brackets and may carry
+// a zone that is an interface name or index
+func StrToSockaddr(addr string) (syscall.Sockaddr, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse address: %v, err: %v", addr, err)
 	}
-	p2, err := strconv.Atoi(ipParts[1])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse address: %v, err: %v", addr, err)
+	if tcpAddr.IP == nil {
+		return nil, fmt.Errorf("malformed address: %v", addr)
 	}
-	p3, err := strconv.Atoi(ipParts[2])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse address: %v, err: %v", addr, err)
+	sa := IPToSockaddr(tcpAddr.IP, tcpAddr.Port)
+	if sa6, ok := sa.(*syscall.SockaddrInet6); ok && tcpAddr.Zone != "" {
+		if ifi, err := net.InterfaceByName(tcpAddr.Zone); err == nil {
+			sa6.ZoneId = uint32(ifi.Index)
+		} else if index, err := strconv.ParseUint(tcpAddr.Zone, 10, 32); err == nil {
+			sa6.ZoneId = uint32(index)
+		}
 	}
-	p4, err := strconv.Atoi(ipParts[3])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse address: %v, err: %v", addr, err)
+	return sa, nil
+}
+
+// IPToSockaddr returns an IPv4 sockaddr for IPv4 and IPv4-mapped addresses and an IPv6 one otherwise
+func IPToSockaddr(ip net.IP, port int) syscall.Sockaddr {
+	if ip4 := ip.To4(); ip4 != nil {
+		sa := &syscall.SockaddrInet4{Port: port}
+		copy(sa.Addr[:], ip4)
+		return sa
+	}
+	sa := &syscall.SockaddrInet6{Port: port}
+	copy(sa.Addr[:], ip.To16())
+	return sa
+}
+
+// SockaddrIP returns the ip and port of an IPv4 or IPv6 sockaddr
+func SockaddrIP(sa syscall.Sockaddr) (net.IP, int) {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return net.IP(sa.Addr[:]), sa.Port
+	case *syscall.SockaddrInet6:
+		return net.IP(sa.Addr[:]), sa.Port
+	default:
+		return nil, 0
 	}
+}
+
+func SockaddrToStr(sa syscall.Sockaddr) string {
+	ip, port := SockaddrIP(sa)
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
 
-	return &syscall.SockaddrInet4{
-		Port: portno,
-		Addr: [4]byte{
-			byte(p1),
-			byte(p2),
-			byte(p3),
-			byte(p4),
-		},
-	}, nil
+// SockaddrFamily returns AF_INET or AF_INET6 for the sockaddr
+func SockaddrFamily(sa syscall.Sockaddr) int {
+	if _, ok := sa.(*syscall.SockaddrInet6); ok {
+		return syscall.AF_INET6
+	}
+	return syscall.AF_INET
+}
+
+// MapSockaddr converts sa so a socket of family can connect to it, IPv4 addresses
+// become IPv4-mapped for IPv6 sockets, it reports false if the family cannot reach sa
+func MapSockaddr(sa syscall.Sockaddr, family int) (syscall.Sockaddr, bool) {
+	ip, port := SockaddrIP(sa)
+	if ip == nil {
+		return nil, false
+	}
+	if family == syscall.AF_INET6 {
+		sa6 := &syscall.SockaddrInet6{Port: port}
+		copy(sa6.Addr[:], ip.To16())
+		if orig, ok := sa.(*syscall.SockaddrInet6); ok {
+			sa6.ZoneId = orig.ZoneId
+		}
+		return sa6, true
+	}
+	if ip.To4() == nil {
+		return nil, false
+	}
+	return IPToSockaddr(ip, port), true
 }
 
-func CreateRegistrationReq(name string, addr *syscall.SockaddrInet4) []byte {
+// sockaddrBytes returns the 4 or 16 ip bytes of sa as they are sent in an Addr
+func sockaddrBytes(sa syscall.Sockaddr) []byte {
+	ip, _ := SockaddrIP(sa)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// Registration holds what a peer sends the negotiator to register
+type Registration struct {
+	Name         string
+	LocalAddr    syscall.Sockaddr
+	SessionToken string
+	Credential   *Credential
+	IdentityKey  []byte
+	Candidates   []Candidate
+	NATType      peer.NATType
+	PortDelta    int32
+	// Hidden leaves the peer out of peer lists
+	Hidden bool
+	// Offers has the negotiator offer every connection to the peer before introducing it
+	Offers bool
+	// Observer only lists and watches peers, the name is authenticated but left to its owner
+	Observer bool
+}
+
+func CreateRegistrationReq(reg *Registration) []byte {
 	b := fb.NewBuilder(256)
 
-	// create address
-	pName := b.CreateString(name)
-	ip := b.CreateByteVector(addr.Addr[:])
+	var pCred fb.UOffsetT
+	if reg.Credential != nil {
+		pCred = addCredential(b, reg.Credential)
+	}
 
-	request.AddrStart(b)
-	request.AddrAddPort(b, int32(addr.Port))
-	request.AddrAddIp(b, ip)
-	pAddr := request.AddrEnd(b)
+	// create address
+	addr := reg.LocalAddr
+	pName := b.CreateString(reg.Name)
+	token := b.CreateString(reg.SessionToken)
+	identityKey := b.CreateByteVector(reg.IdentityKey)
+	cands := addReqCandidates(b, reg.Candidates)
+	pAddr := addReqAddr(b, addr)
 
 	request.RegistrationRequestStart(b)
 	request.RegistrationRequestAddName(b, pName)
 	request.RegistrationRequestAddLocalAddr(b, pAddr)
+	request.RegistrationRequestAddSessionToken(b, token)
+	if reg.Credential != nil {
+		request.RegistrationRequestAddCredential(b, pCred)
+	}
+	request.RegistrationRequestAddIdentityKey(b, identityKey)
+	request.RegistrationRequestAddCandidates(b, cands)
+	request.RegistrationRequestAddNatType(b, request.NATType(reg.NATType))
+	request.RegistrationRequestAddPortDelta(b, reg.PortDelta)
+	request.RegistrationRequestAddHidden(b, reg.Hidden)
+	request.RegistrationRequestAddOffers(b, reg.Offers)
+	request.RegistrationRequestAddObserver(b, reg.Observer)
 	rr := request.RegistrationRequestEnd(b)
 
 	request.RequestStart(b)
 	request.RequestAddType(b, request.RequestTypeRegistration)
+	request.RequestAddRequestType(b, request.AllRequestsRegistrationRequest)
 	request.RequestAddRequest(b, rr)
 	r := request.RequestEnd(b)
 
@@ -98,17 +208,19 @@ func CreateRegistrationReq(name string, addr *syscall.SockaddrInet4) []byte {
 	return b.Bytes[b.Head():]
 }
 
-func CreateConnectionRequest(target, requester string) []byte {
+func CreateConnectionRequest(target, requester string, requestID uint32) []byte {
 	b := fb.NewBuilder(0)
 	t := b.CreateString(target)
 	rq := b.CreateString(requester)
 	request.ConnectionRequestStart(b)
 	request.ConnectionRequestAddPeer(b, t)
 	request.ConnectionRequestAddRequester(b, rq)
+	request.ConnectionRequestAddRequestId(b, requestID)
 	cr := request.ConnectionRequestEnd(b)
 
 	request.RequestStart(b)
 	request.RequestAddType(b, request.RequestTypeConnection)
+	request.RequestAddRequestType(b, request.AllRequestsConnectionRequest)
 	request.RequestAddRequest(b, cr)
 	r := request.RequestEnd(b)
 
@@ -117,61 +229,218 @@ func CreateConnectionRequest(target, requester string) []byte {
 	return b.Bytes[b.Head():]
 }
 
-func addAddr(b *fb.Builder, addr *syscall.SockaddrInet4) fb.UOffsetT {
-	ip := b.CreateByteVector(addr.Addr[:])
+// CreateBindingRequest asks the negotiator for the address it observes the connection from
+func CreateBindingRequest(callback bool) []byte {
+	b := fb.NewBuilder(32)
+	request.BindingRequestStart(b)
+	request.BindingRequestAddCallback(b, callback)
+	br := request.BindingRequestEnd(b)
+
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeBinding)
+	request.RequestAddRequestType(b, request.AllRequestsBindingRequest)
+	request.RequestAddRequest(b, br)
+	r := request.RequestEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+// CreateRelayRequest asks the negotiator to relay this connection to target
+func CreateRelayRequest(name, sessionToken, target string) []byte {
+	b := fb.NewBuilder(128)
+	n := b.CreateString(name)
+	token := b.CreateString(sessionToken)
+	t := b.CreateString(target)
+	request.RelayRequestStart(b)
+	request.RelayRequestAddName(b, n)
+	request.RelayRequestAddSessionToken(b, token)
+	request.RelayRequestAddPeer(b, t)
+	rr := request.RelayRequestEnd(b)
+
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeRelay)
+	request.RequestAddRequestType(b, request.AllRequestsRelayRequest)
+	request.RequestAddRequest(b, rr)
+	r := request.RequestEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+// CreateSyncRequest echoes the nonce of a sync so the negotiator can measure the round trip time,
+// mappedPort answers a sync that asked for a sample
+func CreateSyncRequest(nonce uint64, mappedPort int32) []byte {
+	b := fb.NewBuilder(32)
+	request.SyncRequestStart(b)
+	request.SyncRequestAddNonce(b, nonce)
+	request.SyncRequestAddMappedPort(b, mappedPort)
+	sr := request.SyncRequestEnd(b)
+
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeSync)
+	request.RequestAddRequestType(b, request.AllRequestsSyncRequest)
+	request.RequestAddRequest(b, sr)
+	r := request.RequestEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+// CreatePing creates a heartbeat the negotiator answers with a pong
+func CreatePing(sentAt time.Time) []byte {
+	b := fb.NewBuilder(32)
+	request.PingStart(b)
+	request.PingAddSentAt(b, sentAt.UnixNano())
+	pi := request.PingEnd(b)
+
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypePing)
+	request.RequestAddRequestType(b, request.AllRequestsPing)
+	request.RequestAddRequest(b, pi)
+	r := request.RequestEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+// CreateListPeersRequest asks for up to limit registered peers whose names start with prefix,
+// listed after the name after
+func CreateListPeersRequest(prefix, after string, limit, requestID uint32) []byte {
+	b := fb.NewBuilder(64)
+	p := b.CreateString(prefix)
+	a := b.CreateString(after)
+	request.ListPeersRequestStart(b)
+	request.ListPeersRequestAddPrefix(b, p)
+	request.ListPeersRequestAddAfter(b, a)
+	request.ListPeersRequestAddLimit(b, limit)
+	request.ListPeersRequestAddRequestId(b, requestID)
+	lr := request.ListPeersRequestEnd(b)
+
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeListPeers)
+	request.RequestAddRequestType(b, request.AllRequestsListPeersRequest)
+	request.RequestAddRequest(b, lr)
+	r := request.RequestEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+// CreateSubscribeRequest asks to be told when the peers named by names come online or go offline
+func CreateSubscribeRequest(names []string, requestID uint32) []byte {
+	b := fb.NewBuilder(64)
+	offsets := make([]fb.UOffsetT, len(names))
+	for i, n := range names {
+		offsets[i] = b.CreateString(n)
+	}
+	request.SubscribeRequestStartNamesVector(b, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	ns := b.EndVector(len(offsets))
+
+	request.SubscribeRequestStart(b)
+	request.SubscribeRequestAddNames(b, ns)
+	request.SubscribeRequestAddRequestId(b, requestID)
+	sr := request.SubscribeRequestEnd(b)
+
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeSubscribe)
+	request.RequestAddRequestType(b, request.AllRequestsSubscribeRequest)
+	request.RequestAddRequest(b, sr)
+	r := request.RequestEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+// CreateOfferReply accepts or declines the connection offer of sessionID
+func CreateOfferReply(sessionID []byte, accept bool) []byte {
+	b := fb.NewBuilder(64)
+	id := b.CreateByteVector(sessionID)
+	request.OfferReplyStart(b)
+	request.OfferReplyAddSessionId(b, id)
+	request.OfferReplyAddAccept(b, accept)
+	or := request.OfferReplyEnd(b)
+
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeOfferReply)
+	request.RequestAddRequestType(b, request.AllRequestsOfferReply)
+	request.RequestAddRequest(b, or)
+	r := request.RequestEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+func addReqAddr(b *fb.Builder, addr syscall.Sockaddr) fb.UOffsetT {
+	ip := b.CreateByteVector(sockaddrBytes(addr))
+	_, port := SockaddrIP(addr)
+	request.AddrStart(b)
+	request.AddrAddIp(b, ip)
+	request.AddrAddPort(b, int32(port))
+	return request.AddrEnd(b)
+}
+
+func addAddr(b *fb.Builder, addr syscall.Sockaddr) fb.UOffsetT {
+	ip := b.CreateByteVector(sockaddrBytes(addr))
+	_, port := SockaddrIP(addr)
 	peer.AddrStart(b)
 	peer.AddrAddIp(b, ip)
-	peer.AddrAddPort(b, int32(addr.Port))
+	peer.AddrAddPort(b, int32(port))
 	return peer.AddrEnd(b)
 }
 
-func CreatePeer(name string, remoteAddr, localAddr *syscall.SockaddrInet4) *peer.Peer {
-	b := fb.NewBuilder(256)
-	n := b.CreateString(name)
-	laddr := addAddr(b, localAddr)
-	raddr := addAddr(b, remoteAddr)
+// PeerInfo holds what the negotiator tells peers about a registered peer
+type PeerInfo struct {
+	Name        string
+	LocalAddr   syscall.Sockaddr
+	RemoteAddr  syscall.Sockaddr
+	IdentityKey []byte
+	Candidates  []Candidate
+	NATType     peer.NATType
+	PortDelta   int32
+}
+
+func addPeer(b *fb.Builder, info *PeerInfo) fb.UOffsetT {
+	n := b.CreateString(info.Name)
+	laddr := addAddr(b, info.LocalAddr)
+	raddr := addAddr(b, info.RemoteAddr)
+	identityKey := b.CreateByteVector(info.IdentityKey)
+	cands := addPeerCandidates(b, info.Candidates)
 
 	peer.PeerStart(b)
 	peer.PeerAddName(b, n)
 	peer.PeerAddLocalAddr(b, laddr)
 	peer.PeerAddRemoteAddr(b, raddr)
-	p := peer.PeerEnd(b)
-
-	b.Finish(p)
-
-	return peer.GetRootAsPeer(b.FinishedBytes(), p)
+	peer.PeerAddIdentityKey(b, identityKey)
+	peer.PeerAddCandidates(b, cands)
+	peer.PeerAddNatType(b, info.NATType)
+	peer.PeerAddPortDelta(b, info.PortDelta)
+	return peer.PeerEnd(b)
 }
 
 func PeerAddrToStr(addr *peer.Addr) string {
-	return fmt.Sprintf("%v.%v.%v.%v:%v",
-		addr.Ip(0),
-		addr.Ip(1),
-		addr.Ip(2),
-		addr.Ip(3),
-		addr.Port(),
-	)
-}
-
-func PeerAddrToAddrV4(addr *peer.Addr) *syscall.SockaddrInet4 {
-	return &syscall.SockaddrInet4{
-		Addr: [4]byte{
-			byte(addr.Ip(0)),
-			byte(addr.Ip(1)),
-			byte(addr.Ip(2)),
-			byte(addr.Ip(3)),
-		},
-		Port: int(addr.Port()),
-	}
-}
-
-func ReqAddrToAddrV4(addr *request.Addr) *syscall.SockaddrInet4 {
-	return &syscall.SockaddrInet4{
-		Addr: [4]byte{
-			byte(addr.Ip(0)),
-			byte(addr.Ip(1)),
-			byte(addr.Ip(2)),
-			byte(addr.Ip(3)),
-		},
-		Port: int(addr.Port()),
+	return net.JoinHostPort(net.IP(addr.IpBytes()).String(), strconv.Itoa(int(addr.Port())))
+}
+
+// PeerAddrToSockaddr returns nil if the address has neither 4 nor 16 ip bytes
+func PeerAddrToSockaddr(addr *peer.Addr) syscall.Sockaddr {
+	ip := addr.IpBytes()
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return nil
 	}
+	return IPToSockaddr(net.IP(ip), int(addr.Port()))
+}
+
+func ReqAddrToSockaddr(addr *request.Addr) syscall.Sockaddr {
+	return IPToSockaddr(net.IP(addr.IpBytes()), int(addr.Port()))
 }
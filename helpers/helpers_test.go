@@ -0,0 +1,116 @@
+package helpers
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// describe prints the family, ip, port and zone of sa
+func describe(sa syscall.Sockaddr) string {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return fmt.Sprintf("inet4 %v %v", net.IP(sa.Addr[:]), sa.Port)
+	case *syscall.SockaddrInet6:
+		return fmt.Sprintf("inet6 %v %v zone=%v", net.IP(sa.Addr[:]), sa.Port, sa.ZoneId)
+	default:
+		return fmt.Sprint(sa)
+	}
+}
+
+func TestStrToSockaddr(t *testing.T) {
+	cases := []struct{ addr, want string }{
+		{"1.2.3.4:80", "inet4 1.2.3.4 80"},
+		{"[2001:db8::1]:443", "inet6 2001:db8::1 443 zone=0"},
+		{"[::ffff:1.2.3.4]:80", "inet4 1.2.3.4 80"},
+		{"[::1]:8080", "inet6 ::1 8080 zone=0"},
+		{"[fe80::1%7]:80", "inet6 fe80::1 80 zone=7"},
+		{"[fe80::1%nosuchinterface]:80", "inet6 fe80::1 80 zone=0"},
+		{"2001:db8::1:443", ""},
+		{"1.2.3.4", ""},
+		{":80", ""},
+		{"1.2.3.4:http-alt-nonexistent", ""},
+	}
+	if lo, err := net.InterfaceByName("lo"); err == nil {
+		cases = append(cases, struct{ addr, want string }{"[fe80::1%lo]:80", fmt.Sprintf("inet6 fe80::1 80 zone=%v", lo.Index)})
+	}
+	for _, tc := range cases {
+		t.Run(tc.addr, func(t *testing.T) {
+			sa, err := StrToSockaddr(tc.addr)
+			if tc.want == "" {
+				if err == nil {
+					t.Fatalf("expected %v to be refused, got: %v", tc.addr, describe(sa))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse %v, err: %v", tc.addr, err)
+			}
+			expect(t, describe(sa), tc.want)
+		})
+	}
+}
+
+func TestMapSockaddr(t *testing.T) {
+	v4 := IPToSockaddr(net.ParseIP("1.2.3.4"), 80)
+	v6 := &syscall.SockaddrInet6{Port: 443, ZoneId: 3}
+	copy(v6.Addr[:], net.ParseIP("fe80::1"))
+	mapped := &syscall.SockaddrInet6{Port: 80}
+	copy(mapped.Addr[:], net.ParseIP("::ffff:1.2.3.4"))
+
+	cases := []struct {
+		name   string
+		sa     syscall.Sockaddr
+		family int
+		want   string
+	}{
+		{"IPv4 for IPv4", v4, syscall.AF_INET, "inet4 1.2.3.4 80"},
+		{"IPv4 for IPv6 is mapped", v4, syscall.AF_INET6, "inet6 1.2.3.4 80 zone=0"},
+		{"IPv6 for IPv6 keeps the zone", v6, syscall.AF_INET6, "inet6 fe80::1 443 zone=3"},
+		{"IPv6 for IPv4", v6, syscall.AF_INET, ""},
+		{"mapped IPv4 for IPv4", mapped, syscall.AF_INET, "inet4 1.2.3.4 80"},
+		{"mapped IPv4 for IPv6", mapped, syscall.AF_INET6, "inet6 1.2.3.4 80 zone=0"},
+		{"nil", nil, syscall.AF_INET6, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sa, ok := MapSockaddr(tc.sa, tc.family)
+			if tc.want == "" {
+				if ok {
+					t.Fatalf("expected no mapping, got: %v", describe(sa))
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected a mapping")
+			}
+			expect(t, describe(sa), tc.want)
+			if SockaddrFamily(sa) != tc.family {
+				t.Fatalf("expected family %v, got: %v", tc.family, SockaddrFamily(sa))
+			}
+		})
+	}
+}
+
+func TestSockaddrFamily(t *testing.T) {
+	mapped := &syscall.SockaddrInet6{}
+	copy(mapped.Addr[:], net.ParseIP("::ffff:1.2.3.4"))
+	cases := []struct {
+		name string
+		sa   syscall.Sockaddr
+		want int
+	}{
+		{"IPv4", IPToSockaddr(net.ParseIP("1.2.3.4"), 80), syscall.AF_INET},
+		{"IPv6", IPToSockaddr(net.ParseIP("2001:db8::1"), 80), syscall.AF_INET6},
+		{"mapped IPv4 in an IPv6 sockaddr", mapped, syscall.AF_INET6},
+		{"mapped IPv4 parsed", IPToSockaddr(net.ParseIP("::ffff:1.2.3.4"), 80), syscall.AF_INET},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SockaddrFamily(tc.sa); got != tc.want {
+				t.Fatalf("expected %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
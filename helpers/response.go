@@ -0,0 +1,348 @@
+package helpers
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	fb "github.com/google/flatbuffers/go"
+)
+
+// ResponseError is the structured error the negotiator sent back in a response
+type ResponseError struct {
+	Code    peer.ErrorCode
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("negotiator error: code=%v msg=%v", e.Code, e.Message)
+}
+
+func finishResponse(b *fb.Builder, typ peer.ResponseType, payloadType peer.Payload, payload fb.UOffsetT) []byte {
+	return finishRequestResponse(b, typ, 0, payloadType, payload)
+}
+
+// finishRequestResponse finishes a response that answers the request with requestID
+func finishRequestResponse(b *fb.Builder, typ peer.ResponseType, requestID uint32, payloadType peer.Payload, payload fb.UOffsetT) []byte {
+	peer.ResponseStart(b)
+	peer.ResponseAddType(b, typ)
+	peer.ResponseAddPayloadType(b, payloadType)
+	peer.ResponseAddPayload(b, payload)
+	peer.ResponseAddRequestId(b, requestID)
+	r := peer.ResponseEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+func CreateRegistrationAck(info *PeerInfo, status peer.RegistrationStatus, sessionToken string) []byte {
+	b := fb.NewBuilder(256)
+	p := addPeer(b, info)
+	token := b.CreateString(sessionToken)
+
+	peer.RegistrationAckStart(b)
+	peer.RegistrationAckAddPeer(b, p)
+	peer.RegistrationAckAddStatus(b, status)
+	peer.RegistrationAckAddSessionToken(b, token)
+	ack := peer.RegistrationAckEnd(b)
+
+	return finishResponse(b, peer.ResponseTypeRegistration, peer.PayloadRegistrationAck, ack)
+}
+
+// CreateBindingResponse tells a peer the address its connection was observed from
+// and the other addresses of the negotiator
+func CreateBindingResponse(mapped syscall.Sockaddr, others []syscall.Sockaddr) []byte {
+	b := fb.NewBuilder(128)
+	offsets := make([]fb.UOffsetT, len(others))
+	for i, addr := range others {
+		offsets[i] = addAddr(b, addr)
+	}
+	peer.BindingResponseStartOtherAddrsVector(b, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	otherAddrs := b.EndVector(len(offsets))
+	mappedAddr := addAddr(b, mapped)
+
+	peer.BindingResponseStart(b)
+	peer.BindingResponseAddMappedAddr(b, mappedAddr)
+	peer.BindingResponseAddOtherAddrs(b, otherAddrs)
+	br := peer.BindingResponseEnd(b)
+
+	return finishResponse(b, peer.ResponseTypeBinding, peer.PayloadBindingResponse, br)
+}
+
+// CreateIntroduction introduces a peer to punch through to after startDelay, requestID
+// is the connection request it answers or 0 for the peer being connected to, mappedPort
+// is the peer's freshest mapping or 0 if it was not sampled
+func CreateIntroduction(typ peer.ResponseType, info *PeerInfo, sessionID []byte, startDelay time.Duration, mappedPort int32, requestID uint32) []byte {
+	b := fb.NewBuilder(256)
+	p := addPeer(b, info)
+	sid := b.CreateByteVector(sessionID)
+
+	peer.IntroductionStart(b)
+	peer.IntroductionAddPeer(b, p)
+	peer.IntroductionAddSessionId(b, sid)
+	peer.IntroductionAddStartDelay(b, int32(startDelay/time.Millisecond))
+	peer.IntroductionAddMappedPort(b, mappedPort)
+	in := peer.IntroductionEnd(b)
+
+	return finishRequestResponse(b, typ, requestID, peer.PayloadIntroduction, in)
+}
+
+// CreateSync asks a peer to echo nonce right away, with sample set it reports a fresh mapping first
+func CreateSync(nonce uint64, sample bool) []byte {
+	b := fb.NewBuilder(32)
+	peer.SyncStart(b)
+	peer.SyncAddNonce(b, nonce)
+	peer.SyncAddSample(b, sample)
+	sy := peer.SyncEnd(b)
+
+	return finishResponse(b, peer.ResponseTypeSync, peer.PayloadSync, sy)
+}
+
+// CreatePong answers a ping sent at sentAt unix nanoseconds
+func CreatePong(sentAt int64) []byte {
+	b := fb.NewBuilder(32)
+	peer.PongStart(b)
+	peer.PongAddSentAt(b, sentAt)
+	po := peer.PongEnd(b)
+
+	return finishResponse(b, peer.ResponseTypePong, peer.PayloadPong, po)
+}
+
+// PeerEntry is a peer as it appears in a peer list
+type PeerEntry struct {
+	Name        string
+	NATType     peer.NATType
+	IdentityKey []byte
+}
+
+func addPeerEntry(b *fb.Builder, e PeerEntry) fb.UOffsetT {
+	name := b.CreateString(e.Name)
+	key := b.CreateByteVector(e.IdentityKey)
+	peer.PeerEntryStart(b)
+	peer.PeerEntryAddName(b, name)
+	peer.PeerEntryAddNatType(b, e.NATType)
+	peer.PeerEntryAddIdentityKey(b, key)
+	return peer.PeerEntryEnd(b)
+}
+
+// CreatePeerList answers the list request with requestID with a page of peers, next is
+// the name the following page starts after, empty on the last page
+func CreatePeerList(entries []PeerEntry, next string, requestID uint32) []byte {
+	b := fb.NewBuilder(256)
+	offsets := make([]fb.UOffsetT, len(entries))
+	for i, e := range entries {
+		offsets[i] = addPeerEntry(b, e)
+	}
+	peer.PeerListStartPeersVector(b, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	peers := b.EndVector(len(offsets))
+	n := b.CreateString(next)
+
+	peer.PeerListStart(b)
+	peer.PeerListAddPeers(b, peers)
+	peer.PeerListAddNext(b, n)
+	pl := peer.PeerListEnd(b)
+
+	return finishRequestResponse(b, peer.ResponseTypeListPeers, requestID, peer.PayloadPeerList, pl)
+}
+
+// CreatePresence tells a subscriber that a peer came online or went offline
+func CreatePresence(e PeerEntry, online bool) []byte {
+	b := fb.NewBuilder(128)
+	pe := addPeerEntry(b, e)
+	typ := peer.ResponseTypePeerOffline
+	if online {
+		typ = peer.ResponseTypePeerOnline
+	}
+	return finishResponse(b, typ, peer.PayloadPeerEntry, pe)
+}
+
+// CreateOffer asks the target of a connection request whether it accepts a connection from requester
+func CreateOffer(requester PeerEntry, sessionID []byte) []byte {
+	b := fb.NewBuilder(128)
+	pe := addPeerEntry(b, requester)
+	id := b.CreateByteVector(sessionID)
+	peer.IncomingConnectionOfferStart(b)
+	peer.IncomingConnectionOfferAddRequester(b, pe)
+	peer.IncomingConnectionOfferAddSessionId(b, id)
+	of := peer.IncomingConnectionOfferEnd(b)
+
+	return finishResponse(b, peer.ResponseTypeOffer, peer.PayloadIncomingConnectionOffer, of)
+}
+
+// CreateSubscribed acknowledges the subscribe request with requestID
+func CreateSubscribed(requestID uint32) []byte {
+	b := fb.NewBuilder(32)
+	return finishRequestResponse(b, peer.ResponseTypeSubscribe, requestID, peer.PayloadNONE, 0)
+}
+
+// CreateRelayAccepted tells a peer the relayed stream starts right after this response
+func CreateRelayAccepted() []byte {
+	return createEmptyResponse(peer.ResponseTypeRelay)
+}
+
+func createEmptyResponse(typ peer.ResponseType) []byte {
+	b := fb.NewBuilder(16)
+	peer.ResponseStart(b)
+	peer.ResponseAddType(b, typ)
+	r := peer.ResponseEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+func CreateErrorResponse(typ peer.ResponseType, code peer.ErrorCode, msg string) []byte {
+	return CreateRequestErrorResponse(typ, 0, code, msg)
+}
+
+// CreateRequestErrorResponse creates an error response to the request with requestID
+func CreateRequestErrorResponse(typ peer.ResponseType, requestID uint32, code peer.ErrorCode, msg string) []byte {
+	b := fb.NewBuilder(128)
+	m := b.CreateString(msg)
+
+	peer.ErrorStart(b)
+	peer.ErrorAddCode(b, code)
+	peer.ErrorAddMessage(b, m)
+	e := peer.ErrorEnd(b)
+
+	peer.ResponseStart(b)
+	peer.ResponseAddType(b, typ)
+	peer.ResponseAddError(b, e)
+	peer.ResponseAddRequestId(b, requestID)
+	r := peer.ResponseEnd(b)
+
+	b.Finish(r)
+
+	return b.FinishedBytes()
+}
+
+// ResponseErr returns the error carried by the response, or nil if it succeeded
+func ResponseErr(r *peer.Response) error {
+	e := r.Error(&peer.Error{})
+	if e == nil || e.Code() == peer.ErrorCodeNone {
+		return nil
+	}
+	return &ResponseError{Code: e.Code(), Message: string(e.Message())}
+}
+
+// ResponseRegistrationAck extracts the RegistrationAck payload of a registration response
+func ResponseRegistrationAck(r *peer.Response) (*peer.RegistrationAck, error) {
+	t := &fb.Table{}
+	if r.PayloadType() != peer.PayloadRegistrationAck || !r.Payload(t) {
+		return nil, fmt.Errorf("response has no registration ack: type=%v", r.Type())
+	}
+	ack := &peer.RegistrationAck{}
+	ack.Init(t.Bytes, t.Pos)
+	return ack, nil
+}
+
+// ResponseBinding returns the mapped address and the other negotiator addresses of a binding response
+func ResponseBinding(r *peer.Response) (syscall.Sockaddr, []syscall.Sockaddr, error) {
+	t := &fb.Table{}
+	if r.PayloadType() != peer.PayloadBindingResponse || !r.Payload(t) {
+		return nil, nil, fmt.Errorf("response has no binding response: type=%v", r.Type())
+	}
+	br := &peer.BindingResponse{}
+	br.Init(t.Bytes, t.Pos)
+
+	mapped := br.MappedAddr(&peer.Addr{})
+	if mapped == nil || PeerAddrToSockaddr(mapped) == nil {
+		return nil, nil, fmt.Errorf("binding response has no mapped address")
+	}
+	var others []syscall.Sockaddr
+	addr := &peer.Addr{}
+	for i := 0; i < br.OtherAddrsLength(); i++ {
+		if br.OtherAddrs(addr, i) {
+			if sa := PeerAddrToSockaddr(addr); sa != nil {
+				others = append(others, sa)
+			}
+		}
+	}
+	return PeerAddrToSockaddr(mapped), others, nil
+}
+
+// ResponseIntroduction extracts the Introduction payload of a connection response or an introduction
+func ResponseIntroduction(r *peer.Response) (*peer.Introduction, error) {
+	t := &fb.Table{}
+	if r.PayloadType() != peer.PayloadIntroduction || !r.Payload(t) {
+		return nil, fmt.Errorf("response has no introduction: type=%v", r.Type())
+	}
+	in := &peer.Introduction{}
+	in.Init(t.Bytes, t.Pos)
+	if in.Peer(&peer.Peer{}) == nil {
+		return nil, fmt.Errorf("introduction has no peer")
+	}
+	return in, nil
+}
+
+// ResponseSync returns the nonce of a sync and whether it asks for a sample
+func ResponseSync(r *peer.Response) (uint64, bool, error) {
+	t := &fb.Table{}
+	if r.PayloadType() != peer.PayloadSync || !r.Payload(t) {
+		return 0, false, fmt.Errorf("response has no sync: type=%v", r.Type())
+	}
+	sy := &peer.Sync{}
+	sy.Init(t.Bytes, t.Pos)
+	return sy.Nonce(), sy.Sample(), nil
+}
+
+// ResponsePeerList returns the peers of a peer list and the name the next page starts after
+func ResponsePeerList(r *peer.Response) ([]PeerEntry, string, error) {
+	t := &fb.Table{}
+	if r.PayloadType() != peer.PayloadPeerList || !r.Payload(t) {
+		return nil, "", fmt.Errorf("response has no peer list: type=%v", r.Type())
+	}
+	pl := &peer.PeerList{}
+	pl.Init(t.Bytes, t.Pos)
+
+	entries := make([]PeerEntry, 0, pl.PeersLength())
+	e := &peer.PeerEntry{}
+	for i := 0; i < pl.PeersLength(); i++ {
+		if pl.Peers(e, i) {
+			entries = append(entries, peerEntry(e))
+		}
+	}
+	return entries, string(pl.Next()), nil
+}
+
+// ResponsePresence returns the peer of a PeerOnline or PeerOffline event
+func ResponsePresence(r *peer.Response) (PeerEntry, error) {
+	t := &fb.Table{}
+	if r.PayloadType() != peer.PayloadPeerEntry || !r.Payload(t) {
+		return PeerEntry{}, fmt.Errorf("response has no peer entry: type=%v", r.Type())
+	}
+	e := &peer.PeerEntry{}
+	e.Init(t.Bytes, t.Pos)
+	return peerEntry(e), nil
+}
+
+// ResponseOffer returns the requester and the session id of a connection offer
+func ResponseOffer(r *peer.Response) (PeerEntry, []byte, error) {
+	t := &fb.Table{}
+	if r.PayloadType() != peer.PayloadIncomingConnectionOffer || !r.Payload(t) {
+		return PeerEntry{}, nil, fmt.Errorf("response has no connection offer: type=%v", r.Type())
+	}
+	of := &peer.IncomingConnectionOffer{}
+	of.Init(t.Bytes, t.Pos)
+	e := of.Requester(&peer.PeerEntry{})
+	if e == nil {
+		return PeerEntry{}, nil, fmt.Errorf("connection offer has no requester")
+	}
+	return peerEntry(e), append([]byte{}, of.SessionIdBytes()...), nil
+}
+
+func peerEntry(e *peer.PeerEntry) PeerEntry {
+	return PeerEntry{
+		Name:        string(e.Name()),
+		NATType:     e.NatType(),
+		IdentityKey: append([]byte{}, e.IdentityKeyBytes()...),
+	}
+}
@@ -0,0 +1,146 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// parse parses a response that must be well formed
+func parse(t *testing.T, buf []byte) *peer.Response {
+	t.Helper()
+	r, err := ParseResponse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse response, err: %v", err)
+	}
+	return r
+}
+
+func TestResponseErrRoundTrip(t *testing.T) {
+	cases := []struct {
+		name      string
+		buf       []byte
+		typ       peer.ResponseType
+		requestID uint32
+		err       error
+	}{
+		{
+			name: "error",
+			buf:  CreateErrorResponse(peer.ResponseTypeRegistration, peer.ErrorCodeUnauthorized, "not you"),
+			typ:  peer.ResponseTypeRegistration,
+			err:  &ResponseError{Code: peer.ErrorCodeUnauthorized, Message: "not you"},
+		},
+		{
+			name:      "request error",
+			buf:       CreateRequestErrorResponse(peer.ResponseTypeConnection, 9, peer.ErrorCodeOffline, "gone"),
+			typ:       peer.ResponseTypeConnection,
+			requestID: 9,
+			err:       &ResponseError{Code: peer.ErrorCodeOffline, Message: "gone"},
+		},
+		{
+			name:      "error without message",
+			buf:       CreateRequestErrorResponse(peer.ResponseTypeListPeers, 1, peer.ErrorCodeBadRequest, ""),
+			typ:       peer.ResponseTypeListPeers,
+			requestID: 1,
+			err:       &ResponseError{Code: peer.ErrorCodeBadRequest},
+		},
+		{
+			name:      "success",
+			buf:       CreateSubscribed(2),
+			typ:       peer.ResponseTypeSubscribe,
+			requestID: 2,
+		},
+		{
+			name: "empty success",
+			buf:  CreateRelayAccepted(),
+			typ:  peer.ResponseTypeRelay,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := parse(t, tc.buf)
+			expect(t, fmt.Sprintf("%v %v %v", r.Type(), r.RequestId(), ResponseErr(r)), fmt.Sprintf("%v %v %v", tc.typ, tc.requestID, tc.err))
+			var re *ResponseError
+			if tc.err != nil && !errors.As(ResponseErr(r), &re) {
+				t.Fatalf("expected a *ResponseError, got: %T", ResponseErr(r))
+			}
+		})
+	}
+}
+
+func TestPeerListRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, IdentityKeySize)
+	cases := []struct {
+		name    string
+		entries []PeerEntry
+		next    string
+	}{
+		{"empty last page", nil, ""},
+		{"last page", []PeerEntry{{Name: "alice"}}, ""},
+		{"page with more after it", []PeerEntry{
+			{Name: "alice", NATType: peer.NATTypeSymmetric, IdentityKey: key},
+			{Name: "bob", NATType: peer.NATTypeFullCone},
+			{Name: "carol"},
+		}, "carol"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, next, err := ResponsePeerList(parse(t, CreatePeerList(tc.entries, tc.next, 5)))
+			if err != nil {
+				t.Fatalf("failed to read peer list, err: %v", err)
+			}
+			expect(t, fmt.Sprintf("%v %q", entries, next), fmt.Sprintf("%v %q", tc.entries, tc.next))
+		})
+	}
+}
+
+func TestBindingRoundTripWithoutOtherAddrs(t *testing.T) {
+	mapped, others, err := ResponseBinding(parse(t, CreateBindingResponse(IPToSockaddr(net.ParseIP("fd00::7"), 4000), nil)))
+	if err != nil {
+		t.Fatalf("failed to read binding, err: %v", err)
+	}
+	expect(t, fmt.Sprintf("%v %v", SockaddrToStr(mapped), len(others)), "[fd00::7]:4000 0")
+}
+
+func TestSyncRoundTripWithoutSample(t *testing.T) {
+	nonce, sample, err := ResponseSync(parse(t, CreateSync(0, false)))
+	if err != nil {
+		t.Fatalf("failed to read sync, err: %v", err)
+	}
+	expect(t, fmt.Sprintf("%v %v", nonce, sample), "0 false")
+}
+
+func TestResponseReadersRejectOtherTypes(t *testing.T) {
+	readers := []struct {
+		name    string
+		read    func(r *peer.Response) error
+		accepts []string
+	}{
+		{"registration ack", func(r *peer.Response) error { _, err := ResponseRegistrationAck(r); return err }, []string{"registration"}},
+		{"binding", func(r *peer.Response) error { _, _, err := ResponseBinding(r); return err }, []string{"binding"}},
+		{"introduction", func(r *peer.Response) error { _, err := ResponseIntroduction(r); return err }, []string{"connection", "introduction"}},
+		{"sync", func(r *peer.Response) error { _, _, err := ResponseSync(r); return err }, []string{"sync"}},
+		{"peer list", func(r *peer.Response) error { _, _, err := ResponsePeerList(r); return err }, []string{"list peers"}},
+		{"presence", func(r *peer.Response) error { _, err := ResponsePresence(r); return err }, []string{"peer online", "peer offline"}},
+		{"offer", func(r *peer.Response) error { _, _, err := ResponseOffer(r); return err }, []string{"offer"}},
+	}
+	for _, reader := range readers {
+		t.Run(reader.name, func(t *testing.T) {
+			for _, tc := range validResponses(t) {
+				accepted := false
+				for _, name := range reader.accepts {
+					accepted = accepted || name == tc.name
+				}
+				if err := reader.read(parse(t, tc.buf)); accepted && err != nil {
+					t.Fatalf("expected %v to be read, err: %v", tc.name, err)
+				} else if !accepted && err == nil {
+					t.Fatalf("expected %v not to be read as %v", tc.name, reader.name)
+				}
+			}
+		})
+	}
+}
@@ -7,3 +7,11 @@ var sockOpts = [...]int{
 	syscall.SO_REUSEPORT,
 	syscall.SO_KEEPALIVE,
 }
+
+func setSockOpt(fd uintptr, opt int) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, opt, 1)
+}
+
+func listenBacklog(fd uintptr, backlog int) error {
+	return syscall.Listen(int(fd), backlog)
+}
@@ -2,7 +2,19 @@ package helpers
 
 import "syscall"
 
+// soReusePort is SO_REUSEPORT, which the syscall package does not define for linux
+const soReusePort = 0xf
+
 var sockOpts = [...]int{
 	syscall.SO_REUSEADDR,
+	soReusePort,
 	syscall.SO_KEEPALIVE,
 }
+
+func setSockOpt(fd uintptr, opt int) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, opt, 1)
+}
+
+func listenBacklog(fd uintptr, backlog int) error {
+	return syscall.Listen(int(fd), backlog)
+}
@@ -6,3 +6,11 @@ var sockOpts = [...]int{
 	syscall.SO_REUSEADDR,
 	syscall.SO_KEEPALIVE,
 }
+
+func setSockOpt(fd uintptr, opt int) error {
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, opt, 1)
+}
+
+func listenBacklog(fd uintptr, backlog int) error {
+	return syscall.Listen(syscall.Handle(fd), backlog)
+}
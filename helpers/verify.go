@@ -0,0 +1,684 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+	fb "github.com/google/flatbuffers/go"
+)
+
+var ErrMalformedMessage = errors.New("malformed message")
+
+// MaxSubscriptions bounds the names a single subscribe request may carry
+const MaxSubscriptions = 256
+
+// MaxNameLength bounds the bytes of a registered name, it keeps a full page of listed peers within a frame
+const MaxNameLength = 255
+
+// IdentityKeySize is the size of the ed25519 public key peers identify themselves with
+const IdentityKeySize = ed25519.PublicKeySize
+
+// SessionIDSize is the size of the session id of an introduction, peers name it in the hello
+// of every punched connection
+const SessionIDSize = 16
+
+func malformed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %v", ErrMalformedMessage, fmt.Sprintf(format, args...))
+}
+
+// verifier bounds checks flatbuffers tables before the generated accessors touch them,
+// the accessors index the buffer blindly and panic on garbage input
+type verifier struct {
+	buf []byte
+}
+
+func (v *verifier) inRange(pos, size int) bool {
+	return pos >= 0 && size >= 0 && pos <= len(v.buf) && size <= len(v.buf)-pos
+}
+
+func (v *verifier) uint32At(pos int) (int, error) {
+	if !v.inRange(pos, 4) {
+		return 0, malformed("offset %v out of range", pos)
+	}
+	return int(binary.LittleEndian.Uint32(v.buf[pos:])), nil
+}
+
+// verifiedTable is a table whose vtable and inline data are known to be within the buffer
+type verifiedTable struct {
+	v       *verifier
+	pos     int
+	vtable  int
+	vtLen   int
+	tableSz int
+}
+
+func (v *verifier) root() (*verifiedTable, error) {
+	off, err := v.uint32At(0)
+	if err != nil {
+		return nil, err
+	}
+	return v.table(off)
+}
+
+func (v *verifier) table(pos int) (*verifiedTable, error) {
+	if !v.inRange(pos, 4) {
+		return nil, malformed("table at %v out of range", pos)
+	}
+	soff := int(int32(binary.LittleEndian.Uint32(v.buf[pos:])))
+	vt := pos - soff
+	if !v.inRange(vt, 4) {
+		return nil, malformed("vtable of table at %v out of range", pos)
+	}
+	vtLen := int(binary.LittleEndian.Uint16(v.buf[vt:]))
+	tableSz := int(binary.LittleEndian.Uint16(v.buf[vt+2:]))
+	if vtLen < 4 || vtLen%2 != 0 || !v.inRange(vt, vtLen) || !v.inRange(pos, tableSz) {
+		return nil, malformed("vtable of table at %v is malformed", pos)
+	}
+	return &verifiedTable{v: v, pos: pos, vtable: vt, vtLen: vtLen, tableSz: tableSz}, nil
+}
+
+// field returns the position of the field at vtable offset voff, or 0 if it is absent
+func (t *verifiedTable) field(voff, size int) (int, error) {
+	if voff >= t.vtLen {
+		return 0, nil
+	}
+	off := int(binary.LittleEndian.Uint16(t.v.buf[t.vtable+voff:]))
+	if off == 0 {
+		return 0, nil
+	}
+	if off+size > t.tableSz {
+		return 0, malformed("field %v of table at %v out of range", voff, t.pos)
+	}
+	return t.pos + off, nil
+}
+
+func (t *verifiedTable) scalar(voff, size int) error {
+	_, err := t.field(voff, size)
+	return err
+}
+
+// indirect follows the offset stored in the field at voff
+func (t *verifiedTable) indirect(voff int) (int, error) {
+	pos, err := t.field(voff, 4)
+	if err != nil || pos == 0 {
+		return 0, err
+	}
+	off, err := t.v.uint32At(pos)
+	if err != nil {
+		return 0, err
+	}
+	return pos + off, nil
+}
+
+// vector verifies the vector referenced by the field at voff and returns its length
+func (t *verifiedTable) vector(voff, elemSize int) (int, error) {
+	pos, err := t.indirect(voff)
+	if err != nil || pos == 0 {
+		return 0, err
+	}
+	n, err := t.v.uint32At(pos)
+	if err != nil {
+		return 0, err
+	}
+	if n > len(t.v.buf)/elemSize || !t.v.inRange(pos+4, n*elemSize) {
+		return 0, malformed("vector %v of table at %v out of range", voff, t.pos)
+	}
+	return n, nil
+}
+
+func (t *verifiedTable) str(voff int) error {
+	_, err := t.vector(voff, 1)
+	return err
+}
+
+// table verifies the sub table referenced by the field at voff, it returns nil if the field is absent
+func (t *verifiedTable) table(voff int) (*verifiedTable, error) {
+	pos, err := t.indirect(voff)
+	if err != nil || pos == 0 {
+		return nil, err
+	}
+	return t.v.table(pos)
+}
+
+// tables verifies the vector of tables referenced by the field at voff
+func (t *verifiedTable) tables(voff int) ([]*verifiedTable, error) {
+	n, err := t.vector(voff, 4)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	pos, _ := t.indirect(voff)
+	res := make([]*verifiedTable, n)
+	for i := range res {
+		elem := pos + 4 + i*4
+		off, err := t.v.uint32At(elem)
+		if err != nil {
+			return nil, err
+		}
+		if res[i], err = t.v.table(elem + off); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// strs verifies the vector of strings referenced by the field at voff and returns its length
+func (t *verifiedTable) strs(voff int) (int, error) {
+	n, err := t.vector(voff, 4)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	pos, _ := t.indirect(voff)
+	for i := 0; i < n; i++ {
+		elem := pos + 4 + i*4
+		off, err := t.v.uint32At(elem)
+		if err != nil {
+			return 0, err
+		}
+		size, err := t.v.uint32At(elem + off)
+		if err != nil {
+			return 0, err
+		}
+		if !t.v.inRange(elem+off+4, size) {
+			return 0, malformed("string %v of vector %v out of range", i, voff)
+		}
+	}
+	return n, nil
+}
+
+// verifyAddr verifies an Addr of either schema, both lay it out the same
+func verifyAddr(t *verifiedTable) error {
+	n, err := t.vector(4, 1)
+	if err != nil {
+		return err
+	}
+	if n != net.IPv4len && n != net.IPv6len {
+		return malformed("address has %v ip bytes", n)
+	}
+	return t.scalar(6, 4)
+}
+
+func verifyRegistrationRequest(t *verifiedTable) error {
+	n, err := t.vector(4, 1)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return malformed("registration has no name")
+	}
+	if n > MaxNameLength {
+		return malformed("registration name has %v bytes", n)
+	}
+	addr, err := t.table(6)
+	if err != nil {
+		return err
+	}
+	if addr == nil {
+		return malformed("registration has no local address")
+	}
+	if err := verifyAddr(addr); err != nil {
+		return err
+	}
+	if err := t.str(8); err != nil {
+		return err
+	}
+	cred, err := t.table(10)
+	if err != nil {
+		return err
+	}
+	if err := verifyCredential(cred); err != nil {
+		return err
+	}
+	if n, err = t.vector(12, 1); err != nil {
+		return err
+	}
+	if n != 0 && n != IdentityKeySize {
+		return malformed("identity key has %v bytes", n)
+	}
+	cands, err := t.tables(14)
+	if err != nil {
+		return err
+	}
+	if len(cands) > MaxCandidates {
+		return malformed("registration has %v candidates", len(cands))
+	}
+	for _, c := range cands {
+		if err := verifyCandidate(c); err != nil {
+			return err
+		}
+	}
+	if err := t.scalar(16, 1); err != nil {
+		return err
+	}
+	if err := t.scalar(18, 4); err != nil {
+		return err
+	}
+	if err := t.scalar(20, 1); err != nil {
+		return err
+	}
+	if err := t.scalar(22, 1); err != nil {
+		return err
+	}
+	return t.scalar(24, 1)
+}
+
+// verifyCandidate verifies a Candidate of either schema, both lay it out the same
+func verifyCandidate(t *verifiedTable) error {
+	if err := t.scalar(4, 1); err != nil {
+		return err
+	}
+	addr, err := t.table(6)
+	if err != nil {
+		return err
+	}
+	if addr == nil {
+		return malformed("candidate has no address")
+	}
+	if err := verifyAddr(addr); err != nil {
+		return err
+	}
+	return t.scalar(8, 4)
+}
+
+func verifyCredential(t *verifiedTable) error {
+	if t == nil {
+		return nil
+	}
+	if err := t.scalar(4, 1); err != nil {
+		return err
+	}
+	if err := t.str(6); err != nil {
+		return err
+	}
+	if _, err := t.vector(8, 1); err != nil {
+		return err
+	}
+	if err := t.scalar(10, 8); err != nil {
+		return err
+	}
+	_, err := t.vector(12, 1)
+	return err
+}
+
+func verifyConnectionRequest(t *verifiedTable) error {
+	if err := t.str(4); err != nil {
+		return err
+	}
+	if err := t.str(6); err != nil {
+		return err
+	}
+	return t.scalar(8, 4)
+}
+
+func verifyBindingRequest(t *verifiedTable) error {
+	return t.scalar(4, 1)
+}
+
+func verifyRelayRequest(t *verifiedTable) error {
+	for _, voff := range []int{4, 6, 8} {
+		if err := t.str(voff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifySyncRequest(t *verifiedTable) error {
+	if err := t.scalar(4, 8); err != nil {
+		return err
+	}
+	return t.scalar(6, 4)
+}
+
+func verifyPing(t *verifiedTable) error {
+	return t.scalar(4, 8)
+}
+
+func verifyListPeersRequest(t *verifiedTable) error {
+	if err := t.str(4); err != nil {
+		return err
+	}
+	if err := t.str(6); err != nil {
+		return err
+	}
+	if err := t.scalar(8, 4); err != nil {
+		return err
+	}
+	return t.scalar(10, 4)
+}
+
+func verifySubscribeRequest(t *verifiedTable) error {
+	n, err := t.strs(4)
+	if err != nil {
+		return err
+	}
+	if n > MaxSubscriptions {
+		return malformed("subscription has %v names", n)
+	}
+	return t.scalar(6, 4)
+}
+
+func verifyOfferReply(t *verifiedTable) error {
+	if _, err := t.vector(4, 1); err != nil {
+		return err
+	}
+	return t.scalar(6, 1)
+}
+
+// requestBodies maps every request type to the union member it must carry
+var requestBodies = map[request.RequestType]request.AllRequests{
+	request.RequestTypeRegistration: request.AllRequestsRegistrationRequest,
+	request.RequestTypeConnection:   request.AllRequestsConnectionRequest,
+	request.RequestTypeBinding:      request.AllRequestsBindingRequest,
+	request.RequestTypeRelay:        request.AllRequestsRelayRequest,
+	request.RequestTypeSync:         request.AllRequestsSyncRequest,
+	request.RequestTypePing:         request.AllRequestsPing,
+	request.RequestTypeListPeers:    request.AllRequestsListPeersRequest,
+	request.RequestTypeSubscribe:    request.AllRequestsSubscribeRequest,
+	request.RequestTypeOfferReply:   request.AllRequestsOfferReply,
+}
+
+// ParseRequest verifies that buf holds a well formed Request whose union matches its type,
+// the returned request and the table of its union can then be read safely
+func ParseRequest(buf []byte) (*request.Request, *fb.Table, error) {
+	v := &verifier{buf: buf}
+	root, err := v.root()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := root.scalar(4, 1); err != nil {
+		return nil, nil, err
+	}
+	if err := root.scalar(6, 1); err != nil {
+		return nil, nil, err
+	}
+	tab, err := root.table(8)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tab == nil {
+		return nil, nil, malformed("request has no body")
+	}
+
+	req := request.GetRootAsRequest(buf, 0)
+	body := requestBodies[req.Type()]
+	if body == request.AllRequestsNONE || req.RequestType() != body {
+		return nil, nil, malformed("request type %v does not match body %v", req.Type(), req.RequestType())
+	}
+
+	switch body {
+	case request.AllRequestsRegistrationRequest:
+		err = verifyRegistrationRequest(tab)
+	case request.AllRequestsConnectionRequest:
+		err = verifyConnectionRequest(tab)
+	case request.AllRequestsBindingRequest:
+		err = verifyBindingRequest(tab)
+	case request.AllRequestsRelayRequest:
+		err = verifyRelayRequest(tab)
+	case request.AllRequestsSyncRequest:
+		err = verifySyncRequest(tab)
+	case request.AllRequestsPing:
+		err = verifyPing(tab)
+	case request.AllRequestsListPeersRequest:
+		err = verifyListPeersRequest(tab)
+	case request.AllRequestsSubscribeRequest:
+		err = verifySubscribeRequest(tab)
+	case request.AllRequestsOfferReply:
+		err = verifyOfferReply(tab)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reqTable := &fb.Table{}
+	req.Request(reqTable)
+	return req, reqTable, nil
+}
+
+// optionalAddr verifies the Addr referenced by the field at voff if it is present
+func (t *verifiedTable) optionalAddr(voff int) error {
+	addr, err := t.table(voff)
+	if err != nil || addr == nil {
+		return err
+	}
+	return verifyAddr(addr)
+}
+
+func verifyPeer(t *verifiedTable) error {
+	if t == nil {
+		return malformed("peer is missing")
+	}
+	if err := t.str(4); err != nil {
+		return err
+	}
+	for _, voff := range []int{6, 8} {
+		if err := t.optionalAddr(voff); err != nil {
+			return err
+		}
+	}
+	n, err := t.vector(10, 1)
+	if err != nil {
+		return err
+	}
+	if n != 0 && n != IdentityKeySize {
+		return malformed("identity key has %v bytes", n)
+	}
+	cands, err := t.tables(12)
+	if err != nil {
+		return err
+	}
+	for _, c := range cands {
+		if err := verifyCandidate(c); err != nil {
+			return err
+		}
+	}
+	if err := t.scalar(14, 1); err != nil {
+		return err
+	}
+	return t.scalar(16, 4)
+}
+
+func verifyPeerEntry(t *verifiedTable) error {
+	if t == nil {
+		return malformed("peer entry is missing")
+	}
+	if err := t.str(4); err != nil {
+		return err
+	}
+	if err := t.scalar(6, 1); err != nil {
+		return err
+	}
+	n, err := t.vector(8, 1)
+	if err != nil {
+		return err
+	}
+	if n != 0 && n != IdentityKeySize {
+		return malformed("identity key has %v bytes", n)
+	}
+	return nil
+}
+
+func verifyError(t *verifiedTable) error {
+	if t == nil {
+		return nil
+	}
+	if err := t.scalar(4, 2); err != nil {
+		return err
+	}
+	return t.str(6)
+}
+
+func verifyRegistrationAck(t *verifiedTable) error {
+	p, err := t.table(4)
+	if err != nil {
+		return err
+	}
+	if err := verifyPeer(p); err != nil {
+		return err
+	}
+	if err := t.scalar(6, 1); err != nil {
+		return err
+	}
+	return t.str(8)
+}
+
+func verifyBindingResponse(t *verifiedTable) error {
+	if err := t.optionalAddr(4); err != nil {
+		return err
+	}
+	others, err := t.tables(6)
+	if err != nil {
+		return err
+	}
+	for _, addr := range others {
+		if err := verifyAddr(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyIntroduction(t *verifiedTable) error {
+	p, err := t.table(4)
+	if err != nil {
+		return err
+	}
+	if err := verifyPeer(p); err != nil {
+		return err
+	}
+	if _, err := t.vector(6, 1); err != nil {
+		return err
+	}
+	if err := t.scalar(8, 4); err != nil {
+		return err
+	}
+	return t.scalar(10, 4)
+}
+
+func verifySync(t *verifiedTable) error {
+	if err := t.scalar(4, 8); err != nil {
+		return err
+	}
+	return t.scalar(6, 1)
+}
+
+func verifyPong(t *verifiedTable) error {
+	return t.scalar(4, 8)
+}
+
+func verifyPeerList(t *verifiedTable) error {
+	entries, err := t.tables(4)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := verifyPeerEntry(e); err != nil {
+			return err
+		}
+	}
+	return t.str(6)
+}
+
+func verifyOffer(t *verifiedTable) error {
+	e, err := t.table(4)
+	if err != nil {
+		return err
+	}
+	if err := verifyPeerEntry(e); err != nil {
+		return err
+	}
+	_, err = t.vector(6, 1)
+	return err
+}
+
+// responsePayloads maps every response type to the payload it carries unless it is an error
+var responsePayloads = map[peer.ResponseType]peer.Payload{
+	peer.ResponseTypeRegistration: peer.PayloadRegistrationAck,
+	peer.ResponseTypeConnection:   peer.PayloadIntroduction,
+	peer.ResponseTypeIntroduction: peer.PayloadIntroduction,
+	peer.ResponseTypeBinding:      peer.PayloadBindingResponse,
+	peer.ResponseTypeRelay:        peer.PayloadNONE,
+	peer.ResponseTypeSync:         peer.PayloadSync,
+	peer.ResponseTypePong:         peer.PayloadPong,
+	peer.ResponseTypeListPeers:    peer.PayloadPeerList,
+	peer.ResponseTypeSubscribe:    peer.PayloadNONE,
+	peer.ResponseTypePeerOnline:   peer.PayloadPeerEntry,
+	peer.ResponseTypePeerOffline:  peer.PayloadPeerEntry,
+	peer.ResponseTypeOffer:        peer.PayloadIncomingConnectionOffer,
+}
+
+// ParseResponse verifies that buf holds a well formed Response whose payload matches its type,
+// errors may leave the payload out, the returned response and its payload can then be read safely
+func ParseResponse(buf []byte) (*peer.Response, error) {
+	v := &verifier{buf: buf}
+	root, err := v.root()
+	if err != nil {
+		return nil, err
+	}
+	if err := root.scalar(4, 1); err != nil {
+		return nil, err
+	}
+	if err := root.scalar(6, 1); err != nil {
+		return nil, err
+	}
+	tab, err := root.table(8)
+	if err != nil {
+		return nil, err
+	}
+	errTab, err := root.table(10)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyError(errTab); err != nil {
+		return nil, err
+	}
+	if err := root.scalar(12, 4); err != nil {
+		return nil, err
+	}
+
+	resp := peer.GetRootAsResponse(buf, 0)
+	payload, ok := responsePayloads[resp.Type()]
+	if !ok {
+		return nil, malformed("unknown response type %v", resp.Type())
+	}
+	switch {
+	case resp.PayloadType() == payload:
+	case resp.PayloadType() == peer.PayloadNONE && errTab != nil:
+		return resp, nil
+	default:
+		return nil, malformed("response type %v does not match payload %v", resp.Type(), resp.PayloadType())
+	}
+	if payload == peer.PayloadNONE {
+		return resp, nil
+	}
+	if tab == nil {
+		return nil, malformed("response has no payload")
+	}
+
+	switch payload {
+	case peer.PayloadRegistrationAck:
+		err = verifyRegistrationAck(tab)
+	case peer.PayloadBindingResponse:
+		err = verifyBindingResponse(tab)
+	case peer.PayloadIntroduction:
+		err = verifyIntroduction(tab)
+	case peer.PayloadSync:
+		err = verifySync(tab)
+	case peer.PayloadPong:
+		err = verifyPong(tab)
+	case peer.PayloadPeerList:
+		err = verifyPeerList(tab)
+	case peer.PayloadPeerEntry:
+		err = verifyPeerEntry(tab)
+	case peer.PayloadIncomingConnectionOffer:
+		err = verifyOffer(tab)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
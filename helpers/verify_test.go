@@ -0,0 +1,820 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+	fb "github.com/google/flatbuffers/go"
+)
+
+// validRequest is a request built by a Create function and the fields it must read back with
+type validRequest struct {
+	name  string
+	buf   []byte
+	typ   request.RequestType
+	check func(t *testing.T, tab *fb.Table)
+}
+
+func validRequests(t *testing.T) []validRequest {
+	identityKey := bytes.Repeat([]byte{7}, IdentityKeySize)
+	cred, err := NewHMACCredential([]byte("s3cr3t"), "alice", identityKey)
+	if err != nil {
+		t.Fatalf("failed to create credential, err: %v", err)
+	}
+	sessionID := bytes.Repeat([]byte{9}, SessionIDSize)
+
+	return []validRequest{
+		{
+			name: "registration",
+			buf: CreateRegistrationReq(&Registration{
+				Name:         "alice",
+				LocalAddr:    IPToSockaddr(net.ParseIP("10.0.0.1"), 4000),
+				SessionToken: "token",
+				Credential:   cred,
+				IdentityKey:  identityKey,
+				Candidates: []Candidate{
+					{Type: peer.CandidateTypeHost, Addr: IPToSockaddr(net.ParseIP("fd00::1"), 4000), Priority: 42},
+				},
+				NATType:   peer.NATTypeCone,
+				PortDelta: 2,
+				Hidden:    true,
+				Offers:    true,
+				Observer:  true,
+			}),
+			typ: request.RequestTypeRegistration,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.RegistrationRequest{}
+				r.Init(tab.Bytes, tab.Pos)
+				got := fmt.Sprintf("%s %v %s %x %v %v %v %v %v",
+					r.Name(), ReqAddrToSockaddr(r.LocalAddr(&request.Addr{})) != nil, r.SessionToken(), r.IdentityKeyBytes(),
+					r.NatType(), r.PortDelta(), r.Hidden(), r.Offers(), r.Observer())
+				want := fmt.Sprintf("alice true token %x %v 2 true true true", identityKey, request.NATTypeCone)
+				expect(t, got, want)
+				c := ReqCredential(r.Credential(&request.Credential{}))
+				expect(t, fmt.Sprintf("%v %x %v", c.Type, c.MAC, c.Timestamp), fmt.Sprintf("%v %x %v", cred.Type, cred.MAC, cred.Timestamp))
+				cands := ReqCandidates(r)
+				if len(cands) != 1 {
+					t.Fatalf("expected 1 candidate, got: %v", len(cands))
+				}
+				expect(t, fmt.Sprintf("%v %v", SockaddrToStr(cands[0].Addr), cands[0].Priority), "[fd00::1]:4000 42")
+			},
+		},
+		{
+			name: "connection",
+			buf:  CreateConnectionRequest("bob", "alice", 3),
+			typ:  request.RequestTypeConnection,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.ConnectionRequest{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprintf("%s %s %v", r.Peer(), r.Requester(), r.RequestId()), "bob alice 3")
+			},
+		},
+		{
+			name: "binding",
+			buf:  CreateBindingRequest(true),
+			typ:  request.RequestTypeBinding,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.BindingRequest{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprint(r.Callback()), "true")
+			},
+		},
+		{
+			name: "relay",
+			buf:  CreateRelayRequest("alice", "token", "bob"),
+			typ:  request.RequestTypeRelay,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.RelayRequest{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprintf("%s %s %s", r.Name(), r.SessionToken(), r.Peer()), "alice token bob")
+			},
+		},
+		{
+			name: "sync",
+			buf:  CreateSyncRequest(1<<40, 5000),
+			typ:  request.RequestTypeSync,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.SyncRequest{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprintf("%v %v", r.Nonce(), r.MappedPort()), fmt.Sprintf("%v 5000", uint64(1<<40)))
+			},
+		},
+		{
+			name: "ping",
+			buf:  CreatePing(time.Unix(0, 12345)),
+			typ:  request.RequestTypePing,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.Ping{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprint(r.SentAt()), "12345")
+			},
+		},
+		{
+			name: "list peers",
+			buf:  CreateListPeersRequest("al", "alex", 10, 4),
+			typ:  request.RequestTypeListPeers,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.ListPeersRequest{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprintf("%s %s %v %v", r.Prefix(), r.After(), r.Limit(), r.RequestId()), "al alex 10 4")
+			},
+		},
+		{
+			name: "subscribe",
+			buf:  CreateSubscribeRequest([]string{"alice", "team-*"}, 5),
+			typ:  request.RequestTypeSubscribe,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.SubscribeRequest{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprintf("%v %s %s %v", r.NamesLength(), r.Names(0), r.Names(1), r.RequestId()), "2 alice team-* 5")
+			},
+		},
+		{
+			name: "offer reply",
+			buf:  CreateOfferReply(sessionID, true),
+			typ:  request.RequestTypeOfferReply,
+			check: func(t *testing.T, tab *fb.Table) {
+				r := &request.OfferReply{}
+				r.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprintf("%x %v", r.SessionIdBytes(), r.Accept()), fmt.Sprintf("%x true", sessionID))
+			},
+		},
+	}
+}
+
+func expect(t *testing.T, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("expected %q, got: %q", want, got)
+	}
+}
+
+func TestParseRequestRoundTrip(t *testing.T) {
+	for _, tc := range validRequests(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			req, tab, err := ParseRequest(tc.buf)
+			if err != nil {
+				t.Fatalf("failed to parse request, err: %v", err)
+			}
+			if req.Type() != tc.typ {
+				t.Fatalf("expected type %v, got: %v", tc.typ, req.Type())
+			}
+			tc.check(t, tab)
+		})
+	}
+}
+
+func TestParseRequestCoversEveryType(t *testing.T) {
+	tested := map[request.RequestType]bool{}
+	for _, tc := range validRequests(t) {
+		tested[tc.typ] = true
+	}
+	for typ := range request.EnumNamesRequestType {
+		if !tested[typ] {
+			t.Errorf("no round trip test for request type %v", typ)
+		}
+	}
+}
+
+// withRoot returns buf with the root offset replaced
+func withRoot(buf []byte, off uint32) []byte {
+	res := append([]byte{}, buf...)
+	binary.LittleEndian.PutUint32(res, off)
+	return res
+}
+
+// withUint32Before returns buf with the 4 bytes right before the first occurrence of marker replaced,
+// for a string that is its length
+func withUint32Before(t *testing.T, buf, marker []byte, v uint32) []byte {
+	i := bytes.Index(buf, marker)
+	if i < 4 {
+		t.Fatalf("marker %q not found", marker)
+	}
+	res := append([]byte{}, buf...)
+	binary.LittleEndian.PutUint32(res[i-4:], v)
+	return res
+}
+
+// mismatchedRequest claims to be a registration but carries a connection request
+func mismatchedRequest() []byte {
+	b := fb.NewBuilder(64)
+	p := b.CreateString("bob")
+	request.ConnectionRequestStart(b)
+	request.ConnectionRequestAddPeer(b, p)
+	cr := request.ConnectionRequestEnd(b)
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeRegistration)
+	request.RequestAddRequestType(b, request.AllRequestsConnectionRequest)
+	request.RequestAddRequest(b, cr)
+	b.Finish(request.RequestEnd(b))
+	return b.FinishedBytes()
+}
+
+// bodilessRequest is a ping without its body
+func bodilessRequest() []byte {
+	b := fb.NewBuilder(16)
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypePing)
+	request.RequestAddRequestType(b, request.AllRequestsPing)
+	b.Finish(request.RequestEnd(b))
+	return b.FinishedBytes()
+}
+
+// untypedRequest is a ping whose union type is left empty
+func untypedRequest() []byte {
+	b := fb.NewBuilder(32)
+	request.PingStart(b)
+	p := request.PingEnd(b)
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypePing)
+	request.RequestAddRequest(b, p)
+	b.Finish(request.RequestEnd(b))
+	return b.FinishedBytes()
+}
+
+// addresslessRegistration is a registration without the local address the negotiator reads
+func addresslessRegistration() []byte {
+	b := fb.NewBuilder(64)
+	name := b.CreateString("alice")
+	request.RegistrationRequestStart(b)
+	request.RegistrationRequestAddName(b, name)
+	rr := request.RegistrationRequestEnd(b)
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeRegistration)
+	request.RequestAddRequestType(b, request.AllRequestsRegistrationRequest)
+	request.RequestAddRequest(b, rr)
+	b.Finish(request.RequestEnd(b))
+	return b.FinishedBytes()
+}
+
+// namelessRegistration is a registration that leaves the name out
+func namelessRegistration() []byte {
+	b := fb.NewBuilder(64)
+	addr := addReqAddr(b, IPToSockaddr(net.ParseIP("10.0.0.1"), 4000))
+	request.RegistrationRequestStart(b)
+	request.RegistrationRequestAddLocalAddr(b, addr)
+	rr := request.RegistrationRequestEnd(b)
+	request.RequestStart(b)
+	request.RequestAddType(b, request.RequestTypeRegistration)
+	request.RequestAddRequestType(b, request.AllRequestsRegistrationRequest)
+	request.RequestAddRequest(b, rr)
+	b.Finish(request.RequestEnd(b))
+	return b.FinishedBytes()
+}
+
+// unknownTypeRequest carries a ping under a request type no body belongs to
+func unknownTypeRequest() []byte {
+	buf := CreatePing(time.Now())
+	req := request.GetRootAsRequest(buf, 0)
+	req.MutateType(request.RequestType(100))
+	return buf
+}
+
+func TestParseRequestRejectsMalformed(t *testing.T) {
+	conn := CreateConnectionRequest("bobbobbob", "alice", 1)
+	reg := CreateRegistrationReq(&Registration{
+		Name:        "alice",
+		LocalAddr:   IPToSockaddr(net.ParseIP("10.0.0.1"), 4000),
+		IdentityKey: bytes.Repeat([]byte{7}, IdentityKeySize),
+	})
+	sub := CreateSubscribeRequest([]string{"alicealice"}, 1)
+
+	cases := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"short root", []byte{1, 0}},
+		{"root out of range", withRoot(conn, 0xfffffff0)},
+		{"root at the end", withRoot(conn, uint32(len(conn)-2))},
+		{"vtable out of range", func() []byte {
+			res := append([]byte{}, conn...)
+			root := binary.LittleEndian.Uint32(res)
+			binary.LittleEndian.PutUint32(res[root:], 0x7ffffff0)
+			return res
+		}()},
+		{"string out of range", withUint32Before(t, conn, []byte("bobbobbob"), 0x7fffffff)},
+		{"string past the end", withUint32Before(t, conn, []byte("bobbobbob"), uint32(len(conn)))},
+		{"identity key of the wrong size", withUint32Before(t, reg, bytes.Repeat([]byte{7}, IdentityKeySize), 5)},
+		{"vector string out of range", withUint32Before(t, sub, []byte("alicealice"), 0x7fffffff)},
+		{"registration without local address", addresslessRegistration()},
+		{"registration without name", namelessRegistration()},
+		{"registration with empty name", CreateRegistrationReq(&Registration{LocalAddr: IPToSockaddr(net.ParseIP("10.0.0.1"), 4000)})},
+		{"registration with too long name", CreateRegistrationReq(&Registration{
+			Name:      strings.Repeat("a", MaxNameLength+1),
+			LocalAddr: IPToSockaddr(net.ParseIP("10.0.0.1"), 4000),
+		})},
+		{"mismatched union", mismatchedRequest()},
+		{"no union type", untypedRequest()},
+		{"no body", bodilessRequest()},
+		{"unknown type", unknownTypeRequest()},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertMalformed(t, tc.buf)
+		})
+	}
+}
+
+func TestParseRequestRejectsTruncated(t *testing.T) {
+	for _, tc := range validRequests(t) {
+		// the trailing zeros are string terminators and alignment padding no accessor reads
+		content := len(bytes.TrimRight(tc.buf, "\x00"))
+		for n := 0; n < content; n++ {
+			buf := append([]byte{}, tc.buf[:n]...)
+			t.Run(fmt.Sprintf("%v/%v", tc.name, n), func(t *testing.T) {
+				assertMalformed(t, buf)
+			})
+		}
+	}
+}
+
+func assertMalformed(t *testing.T, buf []byte) {
+	t.Helper()
+	_, _, err := parseNoPanic(t, buf)
+	if !errors.Is(err, ErrMalformedMessage) {
+		t.Fatalf("expected %v, got: %v", ErrMalformedMessage, err)
+	}
+}
+
+// TestParseRequestMutated flips random bytes of valid requests, whatever ParseRequest accepts
+// must be readable through the generated accessors without panicking
+func TestParseRequestMutated(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, tc := range validRequests(t) {
+		for i := 0; i < 2000; i++ {
+			buf := append([]byte{}, tc.buf...)
+			for flips := 1 + rnd.Intn(4); flips > 0; flips-- {
+				buf[rnd.Intn(len(buf))] = byte(rnd.Intn(256))
+			}
+			req, tab, err := parseNoPanic(t, buf)
+			if err != nil {
+				if !errors.Is(err, ErrMalformedMessage) {
+					t.Fatalf("%v: expected %v, got: %v", tc.name, ErrMalformedMessage, err)
+				}
+				continue
+			}
+			readAll(t, buf, req, tab)
+		}
+	}
+}
+
+func parseNoPanic(t *testing.T, buf []byte) (req *request.Request, tab *fb.Table, err error) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("ParseRequest panicked on %x: %v", buf, r)
+		}
+	}()
+	return ParseRequest(buf)
+}
+
+// readAll reads every field of a parsed request the way the negotiator may
+func readAll(t *testing.T, buf []byte, req *request.Request, tab *fb.Table) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("reading request %x panicked: %v", buf, r)
+		}
+	}()
+	switch req.Type() {
+	case request.RequestTypeRegistration:
+		r := &request.RegistrationRequest{}
+		r.Init(tab.Bytes, tab.Pos)
+		_, _, _ = r.Name(), r.SessionToken(), r.IdentityKeyBytes()
+		_, _, _, _, _ = r.NatType(), r.PortDelta(), r.Hidden(), r.Offers(), r.Observer()
+		ReqAddrToSockaddr(r.LocalAddr(&request.Addr{}))
+		ReqCredential(r.Credential(&request.Credential{}))
+		ReqCandidates(r)
+	case request.RequestTypeConnection:
+		r := &request.ConnectionRequest{}
+		r.Init(tab.Bytes, tab.Pos)
+		_, _, _ = r.Peer(), r.Requester(), r.RequestId()
+	case request.RequestTypeBinding:
+		r := &request.BindingRequest{}
+		r.Init(tab.Bytes, tab.Pos)
+		r.Callback()
+	case request.RequestTypeRelay:
+		r := &request.RelayRequest{}
+		r.Init(tab.Bytes, tab.Pos)
+		_, _, _ = r.Name(), r.SessionToken(), r.Peer()
+	case request.RequestTypeSync:
+		r := &request.SyncRequest{}
+		r.Init(tab.Bytes, tab.Pos)
+		_, _ = r.Nonce(), r.MappedPort()
+	case request.RequestTypePing:
+		r := &request.Ping{}
+		r.Init(tab.Bytes, tab.Pos)
+		r.SentAt()
+	case request.RequestTypeListPeers:
+		r := &request.ListPeersRequest{}
+		r.Init(tab.Bytes, tab.Pos)
+		_, _, _, _ = r.Prefix(), r.After(), r.Limit(), r.RequestId()
+	case request.RequestTypeSubscribe:
+		r := &request.SubscribeRequest{}
+		r.Init(tab.Bytes, tab.Pos)
+		for i := 0; i < r.NamesLength(); i++ {
+			r.Names(i)
+		}
+		r.RequestId()
+	case request.RequestTypeOfferReply:
+		r := &request.OfferReply{}
+		r.Init(tab.Bytes, tab.Pos)
+		_, _ = r.SessionIdBytes(), r.Accept()
+	default:
+		t.Fatalf("parsed request of unknown type %v", req.Type())
+	}
+}
+
+// validResponse is a response built by a Create function and the fields it must read back with
+type validResponse struct {
+	name  string
+	buf   []byte
+	typ   peer.ResponseType
+	check func(t *testing.T, r *peer.Response)
+}
+
+func validResponses(t *testing.T) []validResponse {
+	identityKey := bytes.Repeat([]byte{7}, IdentityKeySize)
+	sessionID := bytes.Repeat([]byte{9}, SessionIDSize)
+	info := &PeerInfo{
+		Name:        "alice",
+		LocalAddr:   IPToSockaddr(net.ParseIP("10.0.0.1"), 4000),
+		RemoteAddr:  IPToSockaddr(net.ParseIP("fd00::1"), 5000),
+		IdentityKey: identityKey,
+		Candidates: []Candidate{
+			{Type: peer.CandidateTypeServerReflexive, Addr: IPToSockaddr(net.ParseIP("fd00::1"), 5000), Priority: 42},
+		},
+		NATType:   peer.NATTypeSymmetric,
+		PortDelta: 2,
+	}
+	entry := PeerEntry{Name: "bob", NATType: peer.NATTypeCone, IdentityKey: identityKey}
+	checkPeer := func(t *testing.T, p *peer.Peer) {
+		got := fmt.Sprintf("%s %v %v %x %v %v", p.Name(), PeerAddrToStr(p.LocalAddr(&peer.Addr{})), PeerAddrToStr(p.RemoteAddr(&peer.Addr{})),
+			p.IdentityKeyBytes(), p.NatType(), p.PortDelta())
+		expect(t, got, fmt.Sprintf("alice 10.0.0.1:4000 [fd00::1]:5000 %x %v 2", identityKey, peer.NATTypeSymmetric))
+		cands := PeerCandidates(p)
+		if len(cands) != 1 {
+			t.Fatalf("expected 1 candidate, got: %v", len(cands))
+		}
+		expect(t, fmt.Sprintf("%v %v", SockaddrToStr(cands[0].Addr), cands[0].Priority), "[fd00::1]:5000 42")
+	}
+	checkIntroduction := func(requestID uint32) func(t *testing.T, r *peer.Response) {
+		return func(t *testing.T, r *peer.Response) {
+			in, err := ResponseIntroduction(r)
+			if err != nil {
+				t.Fatalf("failed to read introduction, err: %v", err)
+			}
+			checkPeer(t, in.Peer(&peer.Peer{}))
+			expect(t, fmt.Sprintf("%x %v %v %v", in.SessionIdBytes(), in.StartDelay(), in.MappedPort(), r.RequestId()),
+				fmt.Sprintf("%x 150 6000 %v", sessionID, requestID))
+		}
+	}
+	checkPresence := func(t *testing.T, r *peer.Response) {
+		e, err := ResponsePresence(r)
+		if err != nil {
+			t.Fatalf("failed to read presence, err: %v", err)
+		}
+		expect(t, fmt.Sprintf("%v %v %x", e.Name, e.NATType, e.IdentityKey), fmt.Sprintf("bob %v %x", peer.NATTypeCone, identityKey))
+	}
+
+	return []validResponse{
+		{
+			name: "registration",
+			buf:  CreateRegistrationAck(info, peer.RegistrationStatusResumed, "token"),
+			typ:  peer.ResponseTypeRegistration,
+			check: func(t *testing.T, r *peer.Response) {
+				ack, err := ResponseRegistrationAck(r)
+				if err != nil {
+					t.Fatalf("failed to read registration ack, err: %v", err)
+				}
+				checkPeer(t, ack.Peer(&peer.Peer{}))
+				expect(t, fmt.Sprintf("%v %s", ack.Status(), ack.SessionToken()), fmt.Sprintf("%v token", peer.RegistrationStatusResumed))
+			},
+		},
+		{
+			name: "registration error",
+			buf:  CreateErrorResponse(peer.ResponseTypeRegistration, peer.ErrorCodeNameTaken, "taken"),
+			typ:  peer.ResponseTypeRegistration,
+			check: func(t *testing.T, r *peer.Response) {
+				expect(t, fmt.Sprint(ResponseErr(r)), (&ResponseError{Code: peer.ErrorCodeNameTaken, Message: "taken"}).Error())
+			},
+		},
+		{
+			name:  "connection",
+			buf:   CreateIntroduction(peer.ResponseTypeConnection, info, sessionID, 150*time.Millisecond, 6000, 7),
+			typ:   peer.ResponseTypeConnection,
+			check: checkIntroduction(7),
+		},
+		{
+			name:  "introduction",
+			buf:   CreateIntroduction(peer.ResponseTypeIntroduction, info, sessionID, 150*time.Millisecond, 6000, 0),
+			typ:   peer.ResponseTypeIntroduction,
+			check: checkIntroduction(0),
+		},
+		{
+			name: "binding",
+			buf: CreateBindingResponse(IPToSockaddr(net.ParseIP("1.2.3.4"), 4000),
+				[]syscall.Sockaddr{IPToSockaddr(net.ParseIP("fd00::2"), 3478)}),
+			typ: peer.ResponseTypeBinding,
+			check: func(t *testing.T, r *peer.Response) {
+				mapped, others, err := ResponseBinding(r)
+				if err != nil {
+					t.Fatalf("failed to read binding, err: %v", err)
+				}
+				if len(others) != 1 {
+					t.Fatalf("expected 1 other address, got: %v", len(others))
+				}
+				expect(t, fmt.Sprintf("%v %v", SockaddrToStr(mapped), SockaddrToStr(others[0])), "1.2.3.4:4000 [fd00::2]:3478")
+			},
+		},
+		{
+			name: "relay",
+			buf:  CreateRelayAccepted(),
+			typ:  peer.ResponseTypeRelay,
+			check: func(t *testing.T, r *peer.Response) {
+				expect(t, fmt.Sprint(ResponseErr(r)), "<nil>")
+			},
+		},
+		{
+			name: "sync",
+			buf:  CreateSync(1<<40, true),
+			typ:  peer.ResponseTypeSync,
+			check: func(t *testing.T, r *peer.Response) {
+				nonce, sample, err := ResponseSync(r)
+				if err != nil {
+					t.Fatalf("failed to read sync, err: %v", err)
+				}
+				expect(t, fmt.Sprintf("%v %v", nonce, sample), fmt.Sprintf("%v true", uint64(1<<40)))
+			},
+		},
+		{
+			name: "pong",
+			buf:  CreatePong(12345),
+			typ:  peer.ResponseTypePong,
+			check: func(t *testing.T, r *peer.Response) {
+				tab := &fb.Table{}
+				r.Payload(tab)
+				po := &peer.Pong{}
+				po.Init(tab.Bytes, tab.Pos)
+				expect(t, fmt.Sprint(po.SentAt()), "12345")
+			},
+		},
+		{
+			name: "list peers",
+			buf:  CreatePeerList([]PeerEntry{entry}, "bob", 3),
+			typ:  peer.ResponseTypeListPeers,
+			check: func(t *testing.T, r *peer.Response) {
+				entries, next, err := ResponsePeerList(r)
+				if err != nil {
+					t.Fatalf("failed to read peer list, err: %v", err)
+				}
+				if len(entries) != 1 {
+					t.Fatalf("expected 1 peer, got: %v", len(entries))
+				}
+				expect(t, fmt.Sprintf("%v %v %v", entries[0].Name, next, r.RequestId()), "bob bob 3")
+			},
+		},
+		{
+			name: "subscribe",
+			buf:  CreateSubscribed(4),
+			typ:  peer.ResponseTypeSubscribe,
+			check: func(t *testing.T, r *peer.Response) {
+				expect(t, fmt.Sprint(r.RequestId()), "4")
+			},
+		},
+		{
+			name:  "peer online",
+			buf:   CreatePresence(entry, true),
+			typ:   peer.ResponseTypePeerOnline,
+			check: checkPresence,
+		},
+		{
+			name:  "peer offline",
+			buf:   CreatePresence(entry, false),
+			typ:   peer.ResponseTypePeerOffline,
+			check: checkPresence,
+		},
+		{
+			name: "offer",
+			buf:  CreateOffer(entry, sessionID),
+			typ:  peer.ResponseTypeOffer,
+			check: func(t *testing.T, r *peer.Response) {
+				requester, sid, err := ResponseOffer(r)
+				if err != nil {
+					t.Fatalf("failed to read offer, err: %v", err)
+				}
+				expect(t, fmt.Sprintf("%v %x", requester.Name, sid), fmt.Sprintf("bob %x", sessionID))
+			},
+		},
+	}
+}
+
+func TestParseResponseRoundTrip(t *testing.T) {
+	for _, tc := range validResponses(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := ParseResponse(tc.buf)
+			if err != nil {
+				t.Fatalf("failed to parse response, err: %v", err)
+			}
+			if resp.Type() != tc.typ {
+				t.Fatalf("expected type %v, got: %v", tc.typ, resp.Type())
+			}
+			tc.check(t, resp)
+		})
+	}
+}
+
+func TestParseResponseCoversEveryType(t *testing.T) {
+	tested := map[peer.ResponseType]bool{}
+	for _, tc := range validResponses(t) {
+		tested[tc.typ] = true
+	}
+	for typ := range peer.EnumNamesResponseType {
+		if !tested[typ] {
+			t.Errorf("no round trip test for response type %v", typ)
+		}
+	}
+}
+
+// withResponseType returns buf with the response type replaced
+func withResponseType(buf []byte, typ peer.ResponseType) []byte {
+	res := append([]byte{}, buf...)
+	peer.GetRootAsResponse(res, 0).MutateType(typ)
+	return res
+}
+
+// peerlessIntroduction is an introduction that does not say who to connect to
+func peerlessIntroduction() []byte {
+	b := fb.NewBuilder(64)
+	sid := b.CreateByteVector(bytes.Repeat([]byte{9}, SessionIDSize))
+	peer.IntroductionStart(b)
+	peer.IntroductionAddSessionId(b, sid)
+	in := peer.IntroductionEnd(b)
+	return finishRequestResponse(b, peer.ResponseTypeConnection, 1, peer.PayloadIntroduction, in)
+}
+
+// bodilessResponse claims a sync payload but carries none
+func bodilessResponse() []byte {
+	b := fb.NewBuilder(16)
+	peer.ResponseStart(b)
+	peer.ResponseAddType(b, peer.ResponseTypeSync)
+	peer.ResponseAddPayloadType(b, peer.PayloadSync)
+	b.Finish(peer.ResponseEnd(b))
+	return b.FinishedBytes()
+}
+
+func TestParseResponseRejectsMalformed(t *testing.T) {
+	identityKey := bytes.Repeat([]byte{7}, IdentityKeySize)
+	presence := CreatePresence(PeerEntry{Name: "bobbobbob", IdentityKey: identityKey}, true)
+	intro := CreateIntroduction(peer.ResponseTypeConnection, &PeerInfo{
+		Name:       "alice",
+		LocalAddr:  IPToSockaddr(net.ParseIP("10.9.8.7"), 4000),
+		RemoteAddr: IPToSockaddr(net.ParseIP("10.9.8.7"), 4000),
+	}, bytes.Repeat([]byte{9}, SessionIDSize), 0, 0, 1)
+	errResp := CreateErrorResponse(peer.ResponseTypeRegistration, peer.ErrorCodeNameTaken, "takentaken")
+
+	cases := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"short root", []byte{1, 0}},
+		{"root out of range", withRoot(presence, 0xfffffff0)},
+		{"root at the end", withRoot(presence, uint32(len(presence)-2))},
+		{"string out of range", withUint32Before(t, presence, []byte("bobbobbob"), 0x7fffffff)},
+		{"identity key of the wrong size", withUint32Before(t, presence, identityKey, 5)},
+		{"address of the wrong size", withUint32Before(t, intro, []byte{10, 9, 8, 7}, 5)},
+		{"error message out of range", withUint32Before(t, errResp, []byte("takentaken"), 0x7fffffff)},
+		{"introduction without peer", peerlessIntroduction()},
+		{"mismatched payload", withResponseType(CreateSync(1, false), peer.ResponseTypePeerOnline)},
+		{"success without payload", createEmptyResponse(peer.ResponseTypeRegistration)},
+		{"no payload table", bodilessResponse()},
+		{"unknown type", withResponseType(CreatePong(1), peer.ResponseType(100))},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertMalformedResponse(t, tc.buf)
+		})
+	}
+}
+
+func TestParseResponseRejectsTruncated(t *testing.T) {
+	for _, tc := range validResponses(t) {
+		// the trailing zeros are string terminators and alignment padding no accessor reads
+		content := len(bytes.TrimRight(tc.buf, "\x00"))
+		for n := 0; n < content; n++ {
+			buf := append([]byte{}, tc.buf[:n]...)
+			t.Run(fmt.Sprintf("%v/%v", tc.name, n), func(t *testing.T) {
+				assertMalformedResponse(t, buf)
+			})
+		}
+	}
+}
+
+func assertMalformedResponse(t *testing.T, buf []byte) {
+	t.Helper()
+	_, err := parseResponseNoPanic(t, buf)
+	if !errors.Is(err, ErrMalformedMessage) {
+		t.Fatalf("expected %v, got: %v", ErrMalformedMessage, err)
+	}
+}
+
+// TestParseResponseMutated flips random bytes of valid responses, whatever ParseResponse accepts
+// must be readable the way the client reads it without panicking
+func TestParseResponseMutated(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, tc := range validResponses(t) {
+		for i := 0; i < 2000; i++ {
+			buf := append([]byte{}, tc.buf...)
+			for flips := 1 + rnd.Intn(4); flips > 0; flips-- {
+				buf[rnd.Intn(len(buf))] = byte(rnd.Intn(256))
+			}
+			resp, err := parseResponseNoPanic(t, buf)
+			if err != nil {
+				if !errors.Is(err, ErrMalformedMessage) {
+					t.Fatalf("%v: expected %v, got: %v", tc.name, ErrMalformedMessage, err)
+				}
+				continue
+			}
+			readAllResponse(t, buf, resp)
+		}
+	}
+}
+
+func parseResponseNoPanic(t *testing.T, buf []byte) (resp *peer.Response, err error) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("ParseResponse panicked on %x: %v", buf, r)
+		}
+	}()
+	return ParseResponse(buf)
+}
+
+// readAllResponse reads every field of a parsed response the way the client may
+func readAllResponse(t *testing.T, buf []byte, resp *peer.Response) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("reading response %x panicked: %v", buf, r)
+		}
+	}()
+	readPeer := func(p *peer.Peer) {
+		if p == nil {
+			return
+		}
+		_, _, _, _ = p.Name(), p.IdentityKeyBytes(), p.NatType(), p.PortDelta()
+		for _, addr := range []*peer.Addr{p.LocalAddr(&peer.Addr{}), p.RemoteAddr(&peer.Addr{})} {
+			if addr != nil {
+				PeerAddrToStr(addr)
+			}
+		}
+		PeerCandidates(p)
+	}
+
+	ResponseErr(resp)
+	resp.RequestId()
+	switch resp.Type() {
+	case peer.ResponseTypeRegistration:
+		if ack, err := ResponseRegistrationAck(resp); err == nil {
+			readPeer(ack.Peer(&peer.Peer{}))
+			_, _ = ack.Status(), ack.SessionToken()
+		}
+	case peer.ResponseTypeConnection, peer.ResponseTypeIntroduction:
+		if in, err := ResponseIntroduction(resp); err == nil {
+			readPeer(in.Peer(&peer.Peer{}))
+			_, _, _ = in.SessionIdBytes(), in.StartDelay(), in.MappedPort()
+		}
+	case peer.ResponseTypeBinding:
+		ResponseBinding(resp)
+	case peer.ResponseTypeSync:
+		ResponseSync(resp)
+	case peer.ResponseTypePong:
+		tab := &fb.Table{}
+		if resp.Payload(tab) {
+			po := &peer.Pong{}
+			po.Init(tab.Bytes, tab.Pos)
+			po.SentAt()
+		}
+	case peer.ResponseTypeListPeers:
+		ResponsePeerList(resp)
+	case peer.ResponseTypePeerOnline, peer.ResponseTypePeerOffline:
+		ResponsePresence(resp)
+	case peer.ResponseTypeOffer:
+		ResponseOffer(resp)
+	case peer.ResponseTypeRelay, peer.ResponseTypeSubscribe:
+	default:
+		t.Fatalf("parsed response of unknown type %v", resp.Type())
+	}
+}
@@ -0,0 +1,202 @@
+package negotiator
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+var ErrUnauthorized = errors.New("invalid credential")
+
+// Authenticator checks the credential a peer presents when it registers a name and the identity key
+// it registers with, which is empty for peers without one
+type Authenticator interface {
+	Authenticate(name string, identityKey []byte, cred *helpers.Credential) error
+}
+
+// ACL decides which registered peers may request an introduction to which targets
+type ACL interface {
+	AllowConnection(requester, target string) bool
+}
+
+// MaxClockSkew is how far the timestamp of an HMAC credential may be from the negotiator's clock
+const MaxClockSkew = 5 * time.Minute
+
+type authEntry struct {
+	kind   request.CredentialType
+	secret []byte
+}
+
+// FileAuthenticator authenticates peers against per peer secrets loaded from a file
+type FileAuthenticator struct {
+	entries map[string]authEntry
+
+	mut    sync.Mutex
+	nonces map[string]time.Time
+}
+
+// LoadAuthFile reads an authenticator file, every line holds a peer name,
+// a credential kind (token or hmac) and the secret, "*" matches any name
+// and blank lines and lines starting with # are ignored:
+//
+//	alice  hmac   s3cr3t
+//	bob    token  b0b-t0k3n
+func LoadAuthFile(filename string) (*FileAuthenticator, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := &FileAuthenticator{entries: map[string]authEntry{}, nonces: map[string]time.Time{}}
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%v:%v: expected name, kind and secret", filename, lineno)
+		}
+
+		var kind request.CredentialType
+		switch fields[1] {
+		case "token":
+			kind = request.CredentialTypeToken
+		case "hmac":
+			kind = request.CredentialTypeHMAC
+		default:
+			return nil, fmt.Errorf("%v:%v: unknown credential kind: %v", filename, lineno, fields[1])
+		}
+		a.entries[fields[0]] = authEntry{kind: kind, secret: []byte(fields[2])}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authenticate checks cred against the secret of name, bearer tokens prove nothing about
+// the identity key while HMAC credentials must have been signed over it
+func (a *FileAuthenticator) Authenticate(name string, identityKey []byte, cred *helpers.Credential) error {
+	entry, ok := a.entries[name]
+	if !ok {
+		entry, ok = a.entries["*"]
+	}
+	if !ok || cred == nil || cred.Type != entry.kind {
+		return ErrUnauthorized
+	}
+
+	switch cred.Type {
+	case request.CredentialTypeToken:
+		if subtle.ConstantTimeCompare([]byte(cred.Token), entry.secret) != 1 {
+			return ErrUnauthorized
+		}
+		return nil
+	case request.CredentialTypeHMAC:
+		ts := time.Unix(cred.Timestamp, 0)
+		if d := time.Since(ts); d > MaxClockSkew || d < -MaxClockSkew {
+			return fmt.Errorf("%w: timestamp is too far from the negotiator's clock", ErrUnauthorized)
+		}
+		mac := helpers.RegistrationMAC(entry.secret, name, identityKey, cred.Nonce, cred.Timestamp)
+		if !hmac.Equal(mac, cred.MAC) {
+			return ErrUnauthorized
+		}
+		if !a.useNonce(name, cred.Nonce, ts) {
+			return fmt.Errorf("%w: nonce was already used", ErrUnauthorized)
+		}
+		return nil
+	default:
+		return ErrUnauthorized
+	}
+}
+
+// useNonce remembers the nonce of a valid credential for as long as its timestamp
+// is acceptable and reports false if it has been seen before
+func (a *FileAuthenticator) useNonce(name string, nonce []byte, ts time.Time) bool {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	now := time.Now()
+	for k, expires := range a.nonces {
+		if now.After(expires) {
+			delete(a.nonces, k)
+		}
+	}
+
+	key := name + "\x00" + string(nonce)
+	if _, ok := a.nonces[key]; ok {
+		return false
+	}
+	a.nonces[key] = ts.Add(MaxClockSkew)
+	return true
+}
+
+type aclRule struct {
+	allow     bool
+	requester string
+	target    string
+}
+
+// FileACL is an ACL loaded from a file of ordered rules, the first matching rule wins
+// and requests that match no rule are denied
+type FileACL struct {
+	rules []aclRule
+}
+
+// LoadACLFile reads an ACL file, every line is "allow" or "deny" followed by a requester
+// and a target pattern in path.Match syntax:
+//
+//	deny   mallory  *
+//	allow  alice    bob
+//	allow  *        printer-*
+func LoadACLFile(filename string) (*FileACL, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	acl := &FileACL{}
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 3 || (fields[0] != "allow" && fields[0] != "deny") {
+			return nil, fmt.Errorf("%v:%v: expected allow or deny, requester and target", filename, lineno)
+		}
+		for _, pattern := range fields[1:] {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%v:%v: bad pattern %v, err: %v", filename, lineno, pattern, err)
+			}
+		}
+		acl.rules = append(acl.rules, aclRule{allow: fields[0] == "allow", requester: fields[1], target: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func (acl *FileACL) AllowConnection(requester, target string) bool {
+	for _, r := range acl.rules {
+		rm, _ := path.Match(r.requester, requester)
+		tm, _ := path.Match(r.target, target)
+		if rm && tm {
+			return r.allow
+		}
+	}
+	return false
+}
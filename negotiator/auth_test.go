@@ -0,0 +1,216 @@
+package negotiator
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+// writeFile writes content to a file in a temporary directory of the test and returns its name
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %v, err: %v", filename, err)
+	}
+	return filename
+}
+
+// hmacCredential signs name and identityKey with secret at ts using nonce
+func hmacCredential(secret, name string, identityKey []byte, nonce string, ts time.Time) *helpers.Credential {
+	return &helpers.Credential{
+		Type:      request.CredentialTypeHMAC,
+		Nonce:     []byte(nonce),
+		Timestamp: ts.Unix(),
+		MAC:       helpers.RegistrationMAC([]byte(secret), name, identityKey, []byte(nonce), ts.Unix()),
+	}
+}
+
+const testAuthFile = `
+# peers and their secrets
+alice  hmac   s3cr3t
+bob    token  b0b-t0k3n
+
+*      token  shared
+`
+
+func TestLoadAuthFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		ok      bool
+	}{
+		{"valid", testAuthFile, true},
+		{"empty", "", true},
+		{"missing secret", "alice hmac\n", false},
+		{"extra field", "alice hmac s3cr3t more\n", false},
+		{"unknown kind", "alice password s3cr3t\n", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadAuthFile(writeFile(t, tc.content))
+			if (err == nil) != tc.ok {
+				t.Fatalf("expected ok=%v, got: %v", tc.ok, err)
+			}
+		})
+	}
+
+	if _, err := LoadAuthFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expected loading a missing file to fail")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a, err := LoadAuthFile(writeFile(t, testAuthFile))
+	if err != nil {
+		t.Fatalf("failed to load auth file, err: %v", err)
+	}
+	now := time.Now()
+
+	cases := []struct {
+		name string
+		peer string
+		cred *helpers.Credential
+		ok   bool
+	}{
+		{"token", "bob", helpers.NewTokenCredential("b0b-t0k3n"), true},
+		{"wrong token", "bob", helpers.NewTokenCredential("guess"), false},
+		{"no credential", "bob", nil, false},
+		{"hmac", "alice", hmacCredential("s3cr3t", "alice", nil, "nonce-1", now), true},
+		{"hmac within skew", "alice", hmacCredential("s3cr3t", "alice", nil, "nonce-2", now.Add(-MaxClockSkew+time.Minute)), true},
+		{"hmac too old", "alice", hmacCredential("s3cr3t", "alice", nil, "nonce-3", now.Add(-MaxClockSkew-time.Minute)), false},
+		{"hmac from the future", "alice", hmacCredential("s3cr3t", "alice", nil, "nonce-4", now.Add(MaxClockSkew+time.Minute)), false},
+		{"hmac with wrong secret", "alice", hmacCredential("guess", "alice", nil, "nonce-5", now), false},
+		{"hmac signed for another name", "alice", hmacCredential("s3cr3t", "mallory", nil, "nonce-6", now), false},
+		{"token where hmac is required", "alice", helpers.NewTokenCredential("s3cr3t"), false},
+		{"hmac where a token is required", "bob", hmacCredential("b0b-t0k3n", "bob", nil, "nonce-7", now), false},
+		{"wildcard", "carol", helpers.NewTokenCredential("shared"), true},
+		{"wrong wildcard token", "carol", helpers.NewTokenCredential("guess"), false},
+		{"named entry takes precedence over wildcard", "bob", helpers.NewTokenCredential("shared"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := a.Authenticate(tc.peer, nil, tc.cred)
+			if tc.ok && err != nil {
+				t.Fatalf("expected %v to authenticate, got: %v", tc.peer, err)
+			}
+			if !tc.ok && !errors.Is(err, ErrUnauthorized) {
+				t.Fatalf("expected %v, got: %v", ErrUnauthorized, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsReplayedNonce(t *testing.T) {
+	a, err := LoadAuthFile(writeFile(t, testAuthFile))
+	if err != nil {
+		t.Fatalf("failed to load auth file, err: %v", err)
+	}
+	cred := hmacCredential("s3cr3t", "alice", nil, "nonce", time.Now())
+	if err := a.Authenticate("alice", nil, cred); err != nil {
+		t.Fatalf("expected alice to authenticate, got: %v", err)
+	}
+	if err := a.Authenticate("alice", nil, cred); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected the replayed credential to fail with %v, got: %v", ErrUnauthorized, err)
+	}
+	// a fresh nonce signed with the same timestamp is not a replay
+	if err := a.Authenticate("alice", nil, hmacCredential("s3cr3t", "alice", nil, "other", time.Unix(cred.Timestamp, 0))); err != nil {
+		t.Fatalf("expected a fresh nonce to authenticate, got: %v", err)
+	}
+}
+
+func TestAuthenticateCoversIdentityKey(t *testing.T) {
+	a, err := LoadAuthFile(writeFile(t, testAuthFile))
+	if err != nil {
+		t.Fatalf("failed to load auth file, err: %v", err)
+	}
+	key := bytes.Repeat([]byte{7}, helpers.IdentityKeySize)
+	other := bytes.Repeat([]byte{8}, helpers.IdentityKeySize)
+	now := time.Now()
+
+	// the MAC would be the same if the key's length was not signed
+	movedKey := hmacCredential("s3cr3t", "alice", key, "nonce-5", now)
+	movedKey.Nonce = append(append([]byte{}, key...), movedKey.Nonce...)
+
+	cases := []struct {
+		name string
+		key  []byte
+		cred *helpers.Credential
+		ok   bool
+	}{
+		{"signed key", key, hmacCredential("s3cr3t", "alice", key, "nonce-1", now), true},
+		{"swapped key", other, hmacCredential("s3cr3t", "alice", key, "nonce-2", now), false},
+		{"stripped key", nil, hmacCredential("s3cr3t", "alice", key, "nonce-3", now), false},
+		{"added key", key, hmacCredential("s3cr3t", "alice", nil, "nonce-4", now), false},
+		{"key moved into the nonce", nil, movedKey, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := a.Authenticate("alice", tc.key, tc.cred)
+			if tc.ok && err != nil {
+				t.Fatalf("expected alice to authenticate, got: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, ErrUnauthorized) {
+				t.Fatalf("expected %v, got: %v", ErrUnauthorized, err)
+			}
+		})
+	}
+}
+
+func TestLoadACLFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		ok      bool
+	}{
+		{"valid", "# comment\n\nallow alice bob\ndeny * *\n", true},
+		{"unknown action", "permit alice bob\n", false},
+		{"missing target", "allow alice\n", false},
+		{"bad pattern", "allow [ bob\n", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadACLFile(writeFile(t, tc.content))
+			if (err == nil) != tc.ok {
+				t.Fatalf("expected ok=%v, got: %v", tc.ok, err)
+			}
+		})
+	}
+}
+
+func TestFileACLAllowConnection(t *testing.T) {
+	acl, err := LoadACLFile(writeFile(t, `
+deny   mallory  *
+allow  alice    bob
+allow  *        printer-*
+deny   *        printer-secret
+`))
+	if err != nil {
+		t.Fatalf("failed to load acl file, err: %v", err)
+	}
+
+	cases := []struct {
+		requester, target string
+		allow             bool
+	}{
+		{"alice", "bob", true},
+		{"bob", "alice", false},
+		{"alice", "carol", false},
+		{"carol", "printer-1", true},
+		// the first matching rule wins, so mallory is denied before the printer rule is reached
+		{"mallory", "printer-1", false},
+		// and the later deny never applies to a printer the earlier allow matched
+		{"carol", "printer-secret", true},
+	}
+	for _, tc := range cases {
+		if got := acl.AllowConnection(tc.requester, tc.target); got != tc.allow {
+			t.Errorf("%v -> %v: expected allow=%v, got: %v", tc.requester, tc.target, tc.allow, got)
+		}
+	}
+}
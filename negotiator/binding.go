@@ -0,0 +1,63 @@
+package negotiator
+
+import (
+	"net"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+const callbackTimeout = 2 * time.Second
+
+// handleBindingReq tells a peer the address its connection is observed from, peers send these
+// from the port they punch from, to every negotiator address, to learn how their NAT maps it
+func (s *Server) handleBindingReq(sess *session, r *request.BindingRequest) {
+	mapped, err := helpers.StrToSockaddr(sess.con.RemoteAddr().String())
+	if err != nil {
+		s.logf("failed to parse remote address, err: %v", err)
+		return
+	}
+
+	if err := sess.fr.WriteFrame(helpers.CreateBindingResponse(mapped, s.AlternateAddrs)); err != nil {
+		s.logf("failed to send binding response, err: %v", err)
+		return
+	}
+	if !r.Callback() {
+		return
+	}
+	// one callback comes from the address the peer contacted and another port, it gets through
+	// unless the peer's NAT filters by port, one from an alternate ip gets through unless it filters
+	// by address at all
+	addr, ok := sess.con.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	locals := []net.IP{addr.IP}
+	for _, alt := range s.AlternateAddrs {
+		ip, _ := helpers.SockaddrIP(alt)
+		if !ip.Equal(addr.IP) && (ip.To4() == nil) == (addr.IP.To4() == nil) {
+			locals = append(locals, ip)
+			break
+		}
+	}
+	for _, ip := range locals {
+		// the callbacks are bounded by callbackTimeout, Shutdown waits for them
+		s.handlers.Add(1)
+		go func(ip net.IP) {
+			defer s.handlers.Done()
+			s.callback(sess.con, ip)
+		}(ip)
+	}
+}
+
+// callback connects from ip to the address con was observed from using a port the peer never contacted
+func (s *Server) callback(con net.Conn, ip net.IP) {
+	d := net.Dialer{Timeout: callbackTimeout, LocalAddr: &net.TCPAddr{IP: ip}}
+	c, err := d.Dial("tcp", con.RemoteAddr().String())
+	if err != nil {
+		s.logf("binding callback to %v failed, err: %v", con.RemoteAddr(), err)
+		return
+	}
+	c.Close()
+}
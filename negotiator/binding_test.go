@@ -0,0 +1,49 @@
+package negotiator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+)
+
+func TestBindingCallsBackFromEachIP(t *testing.T) {
+	srv := NewServer(nil)
+	srv.AlternateAddrs = append(srv.AlternateAddrs, helpers.IPToSockaddr(net.ParseIP("127.0.0.2"), 1))
+	addr := startServer(t, srv)
+
+	// the peer listens on the port it sends the binding request from
+	l, err := (&net.ListenConfig{Control: helpers.ControlSocket}).Listen(context.Background(), "tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, err: %v", err)
+	}
+	defer l.Close()
+	p := dialPeerWith(t, &net.Dialer{Control: helpers.ControlSocket, LocalAddr: l.Addr()}, addr)
+	p.send(t, helpers.CreateBindingRequest(true))
+	mapped, _, err := helpers.ResponseBinding(p.read(t))
+	if err != nil {
+		t.Fatalf("failed to read binding response, err: %v", err)
+	}
+	if got := helpers.SockaddrToStr(mapped); got != l.Addr().String() {
+		t.Fatalf("expected the binding to map %v, got: %v", l.Addr(), got)
+	}
+
+	var from []string
+	for len(from) < 2 {
+		l.(*net.TCPListener).SetDeadline(time.Now().Add(testTimeout))
+		con, err := l.Accept()
+		if err != nil {
+			t.Fatalf("expected two callbacks, got: %v, err: %v", from, err)
+		}
+		from = append(from, con.RemoteAddr().(*net.TCPAddr).IP.String())
+		con.Close()
+	}
+	sort.Strings(from)
+	if got := fmt.Sprint(from); got != "[127.0.0.1 127.0.0.2]" {
+		t.Fatalf("expected callbacks from the primary and the alternate ip, got: %v", got)
+	}
+}
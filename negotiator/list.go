@@ -0,0 +1,63 @@
+package negotiator
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+// maxListPeers bounds the peers listed in a single page, names of at most helpers.MaxNameLength
+// bytes keep a full page within a frame
+const maxListPeers = 100
+
+// handleListPeersReq answers a registered peer or an observer with a page of the peers it could
+// connect to, hidden peers, the requester itself and peers the ACL keeps it from are left out
+func (s *Server) handleListPeersReq(sess *session, r *request.ListPeersRequest) {
+	requestID := r.RequestId()
+	if sess.name == "" {
+		sess.fr.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeListPeers, requestID, peer.ErrorCodeNotRegistered,
+			"register before listing peers"))
+		return
+	}
+
+	prefix, after := string(r.Prefix()), string(r.After())
+	limit := int(r.Limit())
+	if limit <= 0 || limit > maxListPeers {
+		limit = maxListPeers
+	}
+
+	var entries []helpers.PeerEntry
+	next := ""
+	for _, p := range s.registry().List() {
+		if p.Name <= after || !strings.HasPrefix(p.Name, prefix) || !s.listable(sess, p) {
+			continue
+		}
+		if len(entries) == limit {
+			next = entries[len(entries)-1].Name
+			break
+		}
+		entries = append(entries, helpers.PeerEntry{Name: p.Name, NATType: p.NATType, IdentityKey: p.IdentityKey})
+	}
+	s.logf("listing peers: peer=%v prefix=%q after=%q count=%v", sess.name, prefix, after, len(entries))
+
+	err := sess.fr.WriteFrame(helpers.CreatePeerList(entries, next, requestID))
+	if errors.Is(err, helpers.ErrFrameTooLarge) {
+		// names registered under the bound always fit, the requester still gets an answer if some did not
+		err = sess.fr.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeListPeers, requestID, peer.ErrorCodeBadRequest,
+			"peer list does not fit a frame, list fewer peers"))
+	}
+	if err != nil {
+		s.logf("failed to send peer list, err: %v", err)
+	}
+}
+
+// listable reports whether p shows up in the peer lists of the connection
+func (s *Server) listable(sess *session, p *Peer) bool {
+	if p.sess == sess || p.Hidden {
+		return false
+	}
+	return s.ACL == nil || s.ACL.AllowConnection(sess.name, p.Name)
+}
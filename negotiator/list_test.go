@@ -0,0 +1,92 @@
+package negotiator
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// listPage lists a page of the peers the test peer sees and returns their names and the next cursor
+func (p *testPeer) listPage(t *testing.T, prefix, after string, limit uint32) (string, string) {
+	t.Helper()
+	p.send(t, helpers.CreateListPeersRequest(prefix, after, limit, 1))
+	entries, next, err := helpers.ResponsePeerList(p.read(t))
+	if err != nil {
+		t.Fatalf("failed to list peers, err: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return fmt.Sprint(names), next
+}
+
+func TestListPeersPages(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	for _, name := range []string{"carol", "alicia", "bob", "alice"} {
+		dialPeer(t, addr).mustRegister(t, name)
+	}
+	zed := dialPeer(t, addr)
+	zed.mustRegister(t, "zed")
+
+	cases := []struct {
+		name          string
+		prefix, after string
+		limit         uint32
+		names, next   string
+	}{
+		{"everyone", "", "", 0, "[alice alicia bob carol]", ""},
+		{"prefix", "ali", "", 0, "[alice alicia]", ""},
+		{"no match", "dave", "", 0, "[]", ""},
+		{"first page", "", "", 2, "[alice alicia]", "alicia"},
+		{"last page", "", "alicia", 2, "[bob carol]", ""},
+		{"prefix page", "ali", "", 1, "[alice]", "alice"},
+		{"prefix after", "ali", "alice", 1, "[alicia]", ""},
+		{"after everyone", "", "carol", 0, "[]", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, next := zed.listPage(t, tc.prefix, tc.after, tc.limit)
+			if names != tc.names || next != tc.next {
+				t.Fatalf("expected %v next=%q, got: %v next=%q", tc.names, tc.next, names, next)
+			}
+		})
+	}
+}
+
+func TestListPeersRequiresRegistration(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	p := dialPeer(t, addr)
+	p.send(t, helpers.CreateListPeersRequest("", "", 0, 1))
+	expectCode(t, p.read(t), peer.ErrorCodeNotRegistered)
+}
+
+func TestFullPeerListFitsAFrame(t *testing.T) {
+	entries := make([]helpers.PeerEntry, maxListPeers)
+	for i := range entries {
+		entries[i] = helpers.PeerEntry{
+			Name:        fmt.Sprintf("%0*d", helpers.MaxNameLength, i),
+			NATType:     peer.NATTypeSymmetric,
+			IdentityKey: bytes.Repeat([]byte{byte(i)}, helpers.IdentityKeySize),
+		}
+	}
+	frame := helpers.CreatePeerList(entries, entries[len(entries)-1].Name, 1)
+	if len(frame) > helpers.MaxFrameSize {
+		t.Fatalf("a full page of %v peers takes %v bytes, more than a frame", maxListPeers, len(frame))
+	}
+}
+
+func TestTooLongNameIsRefused(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	p := dialPeer(t, addr)
+	p.send(t, helpers.CreateRegistrationReq(&helpers.Registration{
+		Name:      strings.Repeat("a", helpers.MaxNameLength+1),
+		LocalAddr: helpers.IPToSockaddr(p.con.LocalAddr().(*net.TCPAddr).IP, 1),
+	}))
+	p.expectClosed(t)
+}
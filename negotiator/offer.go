@@ -0,0 +1,69 @@
+package negotiator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+const defaultOfferTimeout = 30 * time.Second
+
+// offer asks a target registered with offers whether it accepts a connection from requester,
+// it returns the error code and message to answer the requester with unless the target accepted
+func (s *Server) offer(requesterPeer, targetPeer *Peer, sessionID []byte) (peer.ErrorCode, string) {
+	sess := targetPeer.sess
+	answer := make(chan bool, 1)
+	sess.mut.Lock()
+	if sess.offers == nil {
+		sess.offers = map[string]chan bool{}
+	}
+	sess.offers[string(sessionID)] = answer
+	sess.mut.Unlock()
+	defer func() {
+		sess.mut.Lock()
+		delete(sess.offers, string(sessionID))
+		sess.mut.Unlock()
+	}()
+
+	timeout := s.OfferTimeout
+	if timeout == 0 {
+		timeout = defaultOfferTimeout
+	}
+	s.logf("offering connection: from=%v to=%v", requesterPeer.Name, targetPeer.Name)
+	requester := helpers.PeerEntry{Name: requesterPeer.Name, NATType: requesterPeer.NATType, IdentityKey: requesterPeer.IdentityKey}
+	if err := sess.fr.WriteFrame(helpers.CreateOffer(requester, sessionID)); err != nil {
+		s.logf("failed to send connection offer, err: %v", err)
+		return peer.ErrorCodeOffline, fmt.Sprintf("peer %v is offline", targetPeer.Name)
+	}
+
+	select {
+	case accepted := <-answer:
+		if accepted {
+			return peer.ErrorCodeNone, ""
+		}
+		s.logf("connection declined: from=%v to=%v", requesterPeer.Name, targetPeer.Name)
+		return peer.ErrorCodeDeclined, fmt.Sprintf("peer %v declined the connection", targetPeer.Name)
+	case <-time.After(timeout):
+		s.logf("connection offer timed out: from=%v to=%v", requesterPeer.Name, targetPeer.Name)
+		return peer.ErrorCodeDeclined, fmt.Sprintf("peer %v did not answer the connection offer", targetPeer.Name)
+	case <-sess.done:
+		return peer.ErrorCodeOffline, fmt.Sprintf("peer %v is offline", targetPeer.Name)
+	}
+}
+
+func (s *Server) handleOfferReply(sess *session, r *request.OfferReply) {
+	sess.mut.Lock()
+	answer, ok := sess.offers[string(r.SessionIdBytes())]
+	sess.mut.Unlock()
+	if !ok {
+		s.logf("ignoring reply to unknown or expired offer from %v", sess.con.RemoteAddr())
+		return
+	}
+	select {
+	case answer <- r.Accept():
+	default:
+	}
+}
@@ -0,0 +1,113 @@
+package negotiator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// next echoes the syncs the negotiator sends and returns the first other response
+func (p *testPeer) next(t *testing.T) *peer.Response {
+	t.Helper()
+	for {
+		resp := p.read(t)
+		if resp.Type() != peer.ResponseTypeSync {
+			return resp
+		}
+		nonce, _, err := helpers.ResponseSync(resp)
+		if err != nil {
+			t.Fatalf("failed to read sync, err: %v", err)
+		}
+		p.send(t, helpers.CreateSyncRequest(nonce, 0))
+	}
+}
+
+// expectSilence fails the test if the negotiator sends the peer anything for a while
+func (p *testPeer) expectSilence(t *testing.T) {
+	t.Helper()
+	p.con.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if buf, err := p.fr.ReadFrame(); err == nil {
+		resp, _ := helpers.ParseResponse(buf)
+		t.Fatalf("expected nothing to be sent, got: %v", resp.Type())
+	}
+}
+
+// offerPair registers bob with offers and alice, has alice request a connection to bob and
+// returns the session id of the offer bob gets
+func offerPair(t *testing.T, srv *Server) (*testPeer, *testPeer, []byte) {
+	addr := startServer(t, srv)
+	bob := dialPeer(t, addr)
+	if err := helpers.ResponseErr(bob.register(t, &helpers.Registration{Name: "bob", Offers: true})); err != nil {
+		t.Fatalf("failed to register bob, err: %v", err)
+	}
+	alice := dialPeer(t, addr)
+	alice.mustRegister(t, "alice")
+
+	alice.send(t, helpers.CreateConnectionRequest("bob", "alice", 1))
+	resp := bob.next(t)
+	requester, sessionID, err := helpers.ResponseOffer(resp)
+	if err != nil {
+		t.Fatalf("expected bob to be offered the connection, err: %v", err)
+	}
+	if requester.Name != "alice" {
+		t.Fatalf("expected the offer to name alice, got: %v", requester.Name)
+	}
+	// alice learns nothing of bob until he accepts
+	alice.expectSilence(t)
+	return alice, bob, sessionID
+}
+
+func TestOfferAccepted(t *testing.T) {
+	alice, bob, sessionID := offerPair(t, NewServer(nil))
+	bob.send(t, helpers.CreateOfferReply(sessionID, true))
+
+	introduced := make(chan *peer.Response, 1)
+	go func() { introduced <- bob.next(t) }()
+	resp := alice.next(t)
+	in, err := helpers.ResponseIntroduction(resp)
+	if err != nil || resp.Type() != peer.ResponseTypeConnection || resp.RequestId() != 1 {
+		t.Fatalf("expected alice to be introduced to bob, got: %v %v", resp.Type(), err)
+	}
+	if name := string(in.Peer(&peer.Peer{}).Name()); name != "bob" {
+		t.Fatalf("expected alice to be introduced to bob, got: %v", name)
+	}
+	if string(in.SessionIdBytes()) != string(sessionID) {
+		t.Fatalf("expected the introduction to carry the session id of the offer")
+	}
+
+	resp = <-introduced
+	in, err = helpers.ResponseIntroduction(resp)
+	if err != nil || resp.Type() != peer.ResponseTypeIntroduction {
+		t.Fatalf("expected bob to be introduced to alice, got: %v %v", resp.Type(), err)
+	}
+	if name := string(in.Peer(&peer.Peer{}).Name()); name != "alice" {
+		t.Fatalf("expected bob to be introduced to alice, got: %v", name)
+	}
+}
+
+func TestOfferDeclined(t *testing.T) {
+	alice, bob, sessionID := offerPair(t, NewServer(nil))
+	bob.send(t, helpers.CreateOfferReply(sessionID, false))
+	expectCode(t, alice.next(t), peer.ErrorCodeDeclined)
+	bob.expectSilence(t)
+}
+
+func TestOfferTimesOut(t *testing.T) {
+	srv := NewServer(nil)
+	srv.OfferTimeout = 300 * time.Millisecond
+	alice, bob, sessionID := offerPair(t, srv)
+	expectCode(t, alice.next(t), peer.ErrorCodeDeclined)
+
+	// a late answer is ignored
+	bob.send(t, helpers.CreateOfferReply(sessionID, true))
+	alice.expectSilence(t)
+	bob.expectSilence(t)
+}
+
+func TestOfferTargetGoesOffline(t *testing.T) {
+	alice, bob, _ := offerPair(t, NewServer(nil))
+	bob.con.Close()
+	expectCode(t, alice.next(t), peer.ErrorCodeOffline)
+}
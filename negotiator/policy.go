@@ -0,0 +1,125 @@
+package negotiator
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// DuplicatePolicy decides what happens when a peer registers a name that is already taken
+type DuplicatePolicy int
+
+const (
+	// RejectDuplicate refuses the new registration
+	RejectDuplicate DuplicatePolicy = iota
+	// ReplaceDeadDuplicate lets the new registration take the name once the
+	// connection of the registered peer is confirmed dead
+	ReplaceDeadDuplicate
+	// TokenDuplicate lets the new registration take the name only when it presents
+	// the session token the negotiator issued to the registered peer
+	TokenDuplicate
+)
+
+const (
+	defaultProbeTimeout = 2 * time.Second
+	// maxClaimTries bounds how often a name is claimed again when its owner changed meanwhile
+	maxClaimTries = 3
+)
+
+var duplicatePolicyNames = map[DuplicatePolicy]string{
+	RejectDuplicate:      "reject",
+	ReplaceDeadDuplicate: "replace",
+	TokenDuplicate:       "token",
+}
+
+func (p DuplicatePolicy) String() string {
+	if s, ok := duplicatePolicyNames[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+}
+
+// ParseDuplicatePolicy parses the name of a policy as returned by DuplicatePolicy.String
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	for p, name := range duplicatePolicyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return RejectDuplicate, fmt.Errorf("unknown duplicate policy: %v", s)
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isAlive reports whether the connection of a registered peer is still usable, a connection
+// is confirmed dead once it was closed or the peer does not echo a sync in time, a write alone
+// succeeds on a half open connection a NAT timed out
+func (s *Server) isAlive(p *Peer) bool {
+	select {
+	case <-p.sess.done:
+		return false
+	default:
+	}
+
+	timeout := s.ProbeTimeout
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	if _, ok := s.sync(p.sess, timeout); !ok {
+		s.logf("registered peer did not answer the liveness check: name=%v", p.Name)
+		return false
+	}
+	return true
+}
+
+// claimName registers p, resolving a clash with an already registered peer according to the
+// duplicate policy, it returns the registration status or the error code to reply with
+func (s *Server) claimName(p *Peer, token string) (peer.RegistrationStatus, peer.ErrorCode) {
+	reg := s.registry()
+	// a replaced owner may unregister on its own meanwhile, the name is then claimed again
+	for try := 0; try < maxClaimTries; try++ {
+		existing, added := reg.Add(p)
+		if added {
+			return peer.RegistrationStatusRegistered, peer.ErrorCodeNone
+		}
+		// a connection registering the name it holds again updates its registration
+		if existing.sess == p.sess {
+			if reg.Replace(existing, p) {
+				return peer.RegistrationStatusRegistered, peer.ErrorCodeNone
+			}
+			continue
+		}
+
+		switch s.DuplicatePolicy {
+		case ReplaceDeadDuplicate:
+			if s.isAlive(existing) {
+				return 0, peer.ErrorCodeOwnerAlive
+			}
+			if reg.Replace(existing, p) {
+				existing.sess.con.Close()
+				return peer.RegistrationStatusReplaced, peer.ErrorCodeNone
+			}
+		case TokenDuplicate:
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(existing.token)) != 1 {
+				return 0, peer.ErrorCodeInvalidSessionToken
+			}
+			if reg.Replace(existing, p) {
+				existing.sess.con.Close()
+				return peer.RegistrationStatusResumed, peer.ErrorCodeNone
+			}
+		default:
+			return 0, peer.ErrorCodeNameTaken
+		}
+	}
+	return 0, peer.ErrorCodeNameTaken
+}
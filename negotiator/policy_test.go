@@ -0,0 +1,182 @@
+package negotiator
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+func expectCode(t *testing.T, resp *peer.Response, code peer.ErrorCode) {
+	t.Helper()
+	err := helpers.ResponseErr(resp)
+	re, ok := err.(*helpers.ResponseError)
+	if !ok || re.Code != code {
+		t.Fatalf("expected error code %v, got: %v", code, err)
+	}
+}
+
+// listNames lists the peers the test peer sees
+func (p *testPeer) listNames(t *testing.T) string {
+	t.Helper()
+	p.send(t, helpers.CreateListPeersRequest("", "", 0, 1))
+	entries, _, err := helpers.ResponsePeerList(p.read(t))
+	if err != nil {
+		t.Fatalf("failed to list peers, err: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return fmt.Sprint(names)
+}
+
+func TestRefusedRegistrationKeepsHeldName(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	alice := dialPeer(t, addr)
+	alice.mustRegister(t, "alice")
+	dialPeer(t, addr).mustRegister(t, "bob")
+
+	expectCode(t, alice.register(t, &helpers.Registration{Name: "bob"}), peer.ErrorCodeNameTaken)
+
+	carol := dialPeer(t, addr)
+	carol.mustRegister(t, "carol")
+	if got := carol.listNames(t); got != "[alice bob]" {
+		t.Fatalf("expected alice and bob to stay registered, got: %v", got)
+	}
+}
+
+func TestRegisteringAgainReleasesPreviousName(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	alice := dialPeer(t, addr)
+	alice.mustRegister(t, "alice")
+	alice.mustRegister(t, "alice")
+	alice.mustRegister(t, "alicia")
+
+	carol := dialPeer(t, addr)
+	carol.mustRegister(t, "carol")
+	if got := carol.listNames(t); got != "[alicia]" {
+		t.Fatalf("expected only alicia to be registered, got: %v", got)
+	}
+}
+
+// echoSyncs answers the syncs the negotiator sends like a live peer until the connection closes,
+// the test must not read from the peer afterwards
+func (p *testPeer) echoSyncs() {
+	p.con.SetReadDeadline(time.Time{})
+	go func() {
+		for {
+			buf, err := p.fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			resp, err := helpers.ParseResponse(buf)
+			if err != nil || resp.Type() != peer.ResponseTypeSync {
+				continue
+			}
+			if nonce, _, err := helpers.ResponseSync(resp); err == nil {
+				p.fr.WriteFrame(helpers.CreateSyncRequest(nonce, 0))
+			}
+		}
+	}()
+}
+
+// expectClosed reads from the peer until the negotiator closes its connection
+func (p *testPeer) expectClosed(t *testing.T) {
+	t.Helper()
+	p.con.SetReadDeadline(time.Now().Add(testTimeout))
+	for {
+		if _, err := p.fr.ReadFrame(); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Fatalf("connection was not closed")
+			}
+			return
+		}
+	}
+}
+
+func expectStatus(t *testing.T, resp *peer.Response, status peer.RegistrationStatus) *peer.RegistrationAck {
+	t.Helper()
+	if err := helpers.ResponseErr(resp); err != nil {
+		t.Fatalf("registration failed, err: %v", err)
+	}
+	ack, err := helpers.ResponseRegistrationAck(resp)
+	if err != nil {
+		t.Fatalf("malformed registration ack, err: %v", err)
+	}
+	if ack.Status() != status {
+		t.Fatalf("expected status %v, got: %v", status, ack.Status())
+	}
+	return ack
+}
+
+func TestRejectDuplicate(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	dialPeer(t, addr).mustRegister(t, "alice")
+
+	expectCode(t, dialPeer(t, addr).register(t, &helpers.Registration{Name: "alice"}), peer.ErrorCodeNameTaken)
+}
+
+func TestReplaceDeadDuplicate(t *testing.T) {
+	srv := NewServer(nil)
+	srv.DuplicatePolicy = ReplaceDeadDuplicate
+	srv.ProbeTimeout = 200 * time.Millisecond
+	addr := startServer(t, srv)
+
+	t.Run("owner alive", func(t *testing.T) {
+		owner := dialPeer(t, addr)
+		owner.mustRegister(t, "alice")
+		owner.echoSyncs()
+
+		expectCode(t, dialPeer(t, addr).register(t, &helpers.Registration{Name: "alice"}), peer.ErrorCodeOwnerAlive)
+	})
+
+	t.Run("owner dead", func(t *testing.T) {
+		// the owner's connection is open but it never echoes the liveness check
+		owner := dialPeer(t, addr)
+		owner.mustRegister(t, "bob")
+
+		expectStatus(t, dialPeer(t, addr).register(t, &helpers.Registration{Name: "bob"}), peer.RegistrationStatusReplaced)
+		owner.expectClosed(t)
+	})
+
+	t.Run("owner closed", func(t *testing.T) {
+		owner := dialPeer(t, addr)
+		owner.mustRegister(t, "carol")
+		owner.con.Close()
+
+		resp := dialPeer(t, addr).register(t, &helpers.Registration{Name: "carol"})
+		// the negotiator may notice the close before the second registration arrives
+		if err := helpers.ResponseErr(resp); err != nil {
+			t.Fatalf("registration failed, err: %v", err)
+		}
+	})
+}
+
+func TestTokenDuplicate(t *testing.T) {
+	srv := NewServer(nil)
+	srv.DuplicatePolicy = TokenDuplicate
+	addr := startServer(t, srv)
+
+	owner := dialPeer(t, addr)
+	ack := expectStatus(t, owner.register(t, &helpers.Registration{Name: "alice"}), peer.RegistrationStatusRegistered)
+	token := string(ack.SessionToken())
+
+	expectCode(t, dialPeer(t, addr).register(t, &helpers.Registration{Name: "alice"}), peer.ErrorCodeInvalidSessionToken)
+	expectCode(t, dialPeer(t, addr).register(t, &helpers.Registration{Name: "alice", SessionToken: "wrong"}),
+		peer.ErrorCodeInvalidSessionToken)
+
+	resumed := dialPeer(t, addr)
+	ack = expectStatus(t, resumed.register(t, &helpers.Registration{Name: "alice", SessionToken: token}), peer.RegistrationStatusResumed)
+	owner.expectClosed(t)
+
+	// the token is replaced on every registration, the old one no longer resumes the name
+	if string(ack.SessionToken()) == token {
+		t.Fatalf("resumed registration kept the old session token")
+	}
+	expectCode(t, dialPeer(t, addr).register(t, &helpers.Registration{Name: "alice", SessionToken: token}),
+		peer.ErrorCodeInvalidSessionToken)
+}
@@ -0,0 +1,156 @@
+package negotiator
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+// presenceQueueSize is how many presence events may wait for a slow subscriber
+// before its connection is dropped
+const presenceQueueSize = 64
+
+// subscription is what a connection subscribed to and the queue of its presence events, once a
+// connection subscribed or unsubscribed it keeps its queue until it closes
+type subscription struct {
+	sess *session
+	// name is what the subscriber authenticated as, its presence is checked against the ACL
+	name  string
+	names []string
+	// events is drained by a single writer so the acknowledgements and events reach the
+	// subscriber in order
+	events chan []byte
+}
+
+// matches reports whether p is one of the subscribed names, hidden peers only match
+// by their exact name and never by a pattern
+func (sub *subscription) matches(p *Peer) bool {
+	for _, name := range sub.names {
+		if name == p.Name {
+			return true
+		}
+		if ok, _ := path.Match(name, p.Name); ok && !p.Hidden {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSubscribeReq replaces the subscription of a registered peer or an observer and tells
+// it which of the subscribed peers are online right away
+func (s *Server) handleSubscribeReq(sess *session, r *request.SubscribeRequest) {
+	requestID := r.RequestId()
+	if sess.name == "" {
+		sess.fr.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeSubscribe, requestID, peer.ErrorCodeNotRegistered,
+			"register before subscribing"))
+		return
+	}
+	names := make([]string, r.NamesLength())
+	for i := range names {
+		names[i] = string(r.Names(i))
+		if _, err := path.Match(names[i], ""); err != nil {
+			sess.fr.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeSubscribe, requestID, peer.ErrorCodeBadRequest,
+				fmt.Sprintf("bad subscription pattern %v", names[i])))
+			return
+		}
+	}
+
+	s.subMut.Lock()
+	defer s.subMut.Unlock()
+	sub := s.subscribers[sess]
+	if sub == nil {
+		sub = &subscription{sess: sess, events: make(chan []byte, presenceQueueSize)}
+		if s.subscribers == nil {
+			s.subscribers = map[*session]*subscription{}
+		}
+		s.subscribers[sess] = sub
+		go s.sendPresence(sub)
+	}
+	sub.name, sub.names = sess.name, names
+	if len(names) == 0 {
+		s.logf("unsubscribed: peer=%v", sess.name)
+	} else {
+		s.logf("subscribed: peer=%v names=%v", sess.name, names)
+	}
+
+	// the acknowledgement follows the events still queued and goes before any new one, nothing
+	// is written while holding subMut so a subscriber that stops reading cannot hold up other
+	// connections, the events of peers already online are queued while holding it so no later
+	// offline event can overtake them
+	if !s.queue(sub, helpers.CreateSubscribed(requestID)) {
+		return
+	}
+	for _, p := range s.registry().List() {
+		if s.visible(sub, p) && !s.queuePresence(sub, p, true) {
+			return
+		}
+	}
+}
+
+// visible reports whether the subscriber is told about the presence of p, never of its own
+func (s *Server) visible(sub *subscription, p *Peer) bool {
+	if p.sess == sub.sess || !sub.matches(p) {
+		return false
+	}
+	return s.ACL == nil || s.ACL.AllowConnection(sub.name, p.Name)
+}
+
+// notifyPresence tells the subscribers of p that it came online or went offline
+func (s *Server) notifyPresence(p *Peer, online bool) {
+	s.subMut.Lock()
+	defer s.subMut.Unlock()
+	for _, sub := range s.subscribers {
+		if s.visible(sub, p) {
+			s.queuePresence(sub, p, online)
+		}
+	}
+}
+
+// queuePresence queues an event for the subscriber, it reports false if the subscriber was dropped,
+// subMut must be held
+func (s *Server) queuePresence(sub *subscription, p *Peer, online bool) bool {
+	e := helpers.PeerEntry{Name: p.Name, NATType: p.NATType, IdentityKey: p.IdentityKey}
+	return s.queue(sub, helpers.CreatePresence(e, online))
+}
+
+// queue queues a frame for the subscriber, a subscriber that fell too far behind is disconnected
+// rather than left with a wrong picture, it reports false if it was, subMut must be held
+func (s *Server) queue(sub *subscription, frame []byte) bool {
+	select {
+	case sub.events <- frame:
+		return true
+	default:
+		s.logf("subscriber %v is too slow for presence events, closing the connection", sub.sess.con.RemoteAddr())
+		delete(s.subscribers, sub.sess)
+		close(sub.events)
+		sub.sess.con.Close()
+		return false
+	}
+}
+
+// sendPresence writes the queued frames of a subscriber until it disconnects
+func (s *Server) sendPresence(sub *subscription) {
+	failed := false
+	for frame := range sub.events {
+		if failed {
+			continue
+		}
+		if err := sub.sess.fr.WriteFrame(frame); err != nil {
+			s.logf("failed to send presence event, err: %v", err)
+			failed = true
+		}
+	}
+}
+
+// unsubscribe drops the subscription of a closed connection
+func (s *Server) unsubscribe(sess *session) {
+	s.subMut.Lock()
+	defer s.subMut.Unlock()
+	if sub, ok := s.subscribers[sess]; ok {
+		delete(s.subscribers, sess)
+		close(sub.events)
+	}
+}
@@ -0,0 +1,84 @@
+package negotiator
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+func TestStalledSubscriberDoesNotBlockOthers(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+
+	// a tiny receive buffer has the negotiator's writes to mallory stall quickly
+	d := &net.Dialer{Control: func(network, address string, c syscall.RawConn) error {
+		return c.Control(func(fd uintptr) {
+			syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, 1024)
+		})
+	}}
+	mallory := dialPeerWith(t, d, addr)
+	mallory.mustRegister(t, "mallory")
+
+	// mallory keeps subscribing and never reads the acknowledgements, until the negotiator
+	// either stops reading from it or drops it
+	deadline := time.Now().Add(10 * time.Second)
+	for id := uint32(1); time.Now().Before(deadline); id++ {
+		mallory.con.SetWriteDeadline(time.Now().Add(500 * time.Millisecond))
+		if err := mallory.fr.WriteFrame(helpers.CreateSubscribeRequest([]string{"nobody"}, id)); err != nil {
+			break
+		}
+	}
+
+	victim := dialPeer(t, addr)
+	victim.mustRegister(t, "victim")
+	victim.send(t, helpers.CreateSubscribeRequest([]string{"mallory"}, 1))
+	resp := victim.read(t)
+	if resp.Type() != peer.ResponseTypeSubscribe || helpers.ResponseErr(resp) != nil {
+		t.Fatalf("expected a subscribe acknowledgement, got: type=%v err=%v", resp.Type(), helpers.ResponseErr(resp))
+	}
+}
+
+func TestSubscriberFramesStayInOrder(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	const online = 10
+	for i := 0; i < online; i++ {
+		dialPeer(t, addr).mustRegister(t, fmt.Sprintf("peer-%v", i))
+	}
+	watcher := dialPeer(t, addr)
+	watcher.mustRegister(t, "watcher")
+
+	// the presence of the online peers is still queued when the unsubscriptions arrive
+	watcher.send(t, helpers.CreateSubscribeRequest([]string{"peer-*"}, 1))
+	watcher.send(t, helpers.CreateSubscribeRequest(nil, 2))
+	watcher.send(t, helpers.CreateSubscribeRequest(nil, 3))
+
+	var got []string
+	for len(got) < online+3 {
+		resp := watcher.read(t)
+		switch resp.Type() {
+		case peer.ResponseTypeSubscribe:
+			got = append(got, fmt.Sprintf("ack %v", resp.RequestId()))
+		case peer.ResponseTypePeerOnline:
+			got = append(got, "presence")
+		}
+	}
+	want := []string{"ack 1"}
+	for i := 0; i < online; i++ {
+		want = append(want, "presence")
+	}
+	want = append(want, "ack 2", "ack 3")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got: %v", want, got)
+	}
+
+	// nothing more is sent once unsubscribed
+	dialPeer(t, addr).mustRegister(t, "peer-late")
+	watcher.con.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if buf, err := watcher.fr.ReadFrame(); err == nil {
+		t.Fatalf("expected nothing after unsubscribing, got %v bytes", len(buf))
+	}
+}
@@ -0,0 +1,118 @@
+package negotiator
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// Peer is a peer registered with the negotiator
+type Peer struct {
+	Name       string
+	LocalAddr  syscall.Sockaddr
+	RemoteAddr syscall.Sockaddr
+	// IdentityKey is the ed25519 public key the peer registered, if any
+	IdentityKey []byte
+	// Candidates are the addresses the peer may be reachable at, in priority order
+	Candidates []helpers.Candidate
+	// NATType is the NAT behaviour the peer discovered, if it did
+	NATType peer.NATType
+	// PortDelta is how far apart the peer's NAT allocates consecutive mappings, 0 if unknown
+	PortDelta int32
+	// Hidden leaves the peer out of peer lists, it can still be connected to by name
+	Hidden bool
+	// Offers has every connection to the peer offered to it first, it is only introduced once it accepts
+	Offers bool
+
+	sess  *session
+	token string
+}
+
+func (p *Peer) info() *helpers.PeerInfo {
+	return &helpers.PeerInfo{
+		Name:        p.Name,
+		LocalAddr:   p.LocalAddr,
+		RemoteAddr:  p.RemoteAddr,
+		IdentityKey: p.IdentityKey,
+		Candidates:  p.Candidates,
+		NATType:     p.NATType,
+		PortDelta:   p.PortDelta,
+	}
+}
+
+// Registry keeps track of the registered peers by name,
+// implementations must be safe for concurrent use
+type Registry interface {
+	// Add registers p under p.Name unless the name is taken,
+	// in which case it returns the registered peer and false
+	Add(p *Peer) (*Peer, bool)
+	// Replace registers p in place of old only if old is still the peer registered under its name
+	Replace(old, p *Peer) bool
+	Get(name string) (*Peer, bool)
+	// Remove unregisters p only if it is still the peer registered under p.Name,
+	// so a stale connection can never remove the peer that replaced it
+	Remove(p *Peer) bool
+	List() []*Peer
+}
+
+// MemoryRegistry is the default in process Registry
+type MemoryRegistry struct {
+	mut   sync.Mutex
+	peers map[string]*Peer
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{peers: map[string]*Peer{}}
+}
+
+func (r *MemoryRegistry) Add(p *Peer) (*Peer, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if cur, ok := r.peers[p.Name]; ok {
+		return cur, false
+	}
+	r.peers[p.Name] = p
+	return p, true
+}
+
+func (r *MemoryRegistry) Replace(old, p *Peer) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if cur, ok := r.peers[old.Name]; !ok || cur != old || old.Name != p.Name {
+		return false
+	}
+	r.peers[p.Name] = p
+	return true
+}
+
+func (r *MemoryRegistry) Get(name string) (*Peer, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	p, ok := r.peers[name]
+	return p, ok
+}
+
+func (r *MemoryRegistry) Remove(p *Peer) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if cur, ok := r.peers[p.Name]; !ok || cur != p {
+		return false
+	}
+	delete(r.peers, p.Name)
+	return true
+}
+
+// List returns the registered peers sorted by name
+func (r *MemoryRegistry) List() []*Peer {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	peers := make([]*Peer, 0, len(r.peers))
+	for _, p := range r.peers {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	return peers
+}
@@ -0,0 +1,126 @@
+package negotiator
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMemoryRegistryAdd(t *testing.T) {
+	r := NewMemoryRegistry()
+	alice := &Peer{Name: "alice"}
+	if cur, ok := r.Add(alice); !ok || cur != alice {
+		t.Fatalf("expected alice to be added")
+	}
+	if cur, ok := r.Add(&Peer{Name: "alice"}); ok || cur != alice {
+		t.Fatalf("expected the taken name to return the registered alice")
+	}
+	if p, ok := r.Get("alice"); !ok || p != alice {
+		t.Fatalf("expected to get alice")
+	}
+	if _, ok := r.Get("bob"); ok {
+		t.Fatalf("expected bob not to be registered")
+	}
+}
+
+func TestMemoryRegistryRemove(t *testing.T) {
+	r := NewMemoryRegistry()
+	alice := &Peer{Name: "alice"}
+	r.Add(alice)
+
+	if r.Remove(&Peer{Name: "alice"}) {
+		t.Fatalf("expected another peer of the same name not to remove alice")
+	}
+	if p, _ := r.Get("alice"); p != alice {
+		t.Fatalf("expected alice to stay registered")
+	}
+	if !r.Remove(alice) {
+		t.Fatalf("expected alice to be removed")
+	}
+	if _, ok := r.Get("alice"); ok {
+		t.Fatalf("expected alice not to be registered")
+	}
+	if r.Remove(alice) {
+		t.Fatalf("expected removing alice twice to fail")
+	}
+}
+
+func TestMemoryRegistryReplace(t *testing.T) {
+	r := NewMemoryRegistry()
+	stale := &Peer{Name: "alice"}
+	r.Add(stale)
+
+	if r.Replace(&Peer{Name: "alice"}, &Peer{Name: "alice"}) {
+		t.Fatalf("expected replacing a peer that is not registered to fail")
+	}
+	if r.Replace(stale, &Peer{Name: "bob"}) {
+		t.Fatalf("expected replacing alice with another name to fail")
+	}
+	if _, ok := r.Get("bob"); ok {
+		t.Fatalf("expected bob not to be registered")
+	}
+
+	fresh := &Peer{Name: "alice"}
+	if !r.Replace(stale, fresh) {
+		t.Fatalf("expected alice to be replaced")
+	}
+	if p, _ := r.Get("alice"); p != fresh {
+		t.Fatalf("expected the replacement to be registered")
+	}
+
+	// the connection of the replaced peer can neither remove nor replace its successor
+	if r.Remove(stale) {
+		t.Fatalf("expected the stale peer not to remove its replacement")
+	}
+	if r.Replace(stale, &Peer{Name: "alice"}) {
+		t.Fatalf("expected the stale peer not to replace its replacement")
+	}
+	if p, _ := r.Get("alice"); p != fresh {
+		t.Fatalf("expected the replacement to stay registered")
+	}
+}
+
+func TestMemoryRegistryReplaceRace(t *testing.T) {
+	r := NewMemoryRegistry()
+	old := &Peer{Name: "alice"}
+	r.Add(old)
+
+	// only one of the sessions racing to take over the name may win
+	const racers = 16
+	won := make(chan *Peer, racers)
+	for i := 0; i < racers; i++ {
+		go func() {
+			p := &Peer{Name: "alice"}
+			if r.Replace(old, p) {
+				won <- p
+			} else {
+				won <- nil
+			}
+		}()
+	}
+	var winners []*Peer
+	for i := 0; i < racers; i++ {
+		if p := <-won; p != nil {
+			winners = append(winners, p)
+		}
+	}
+	if len(winners) != 1 {
+		t.Fatalf("expected one replacement to win, got: %v", len(winners))
+	}
+	if p, _ := r.Get("alice"); p != winners[0] {
+		t.Fatalf("expected the winner to be registered")
+	}
+}
+
+func TestMemoryRegistryList(t *testing.T) {
+	r := NewMemoryRegistry()
+	for _, name := range []string{"carol", "alice", "bob"} {
+		r.Add(&Peer{Name: name})
+	}
+	var names []string
+	for _, p := range r.List() {
+		names = append(names, p.Name)
+	}
+	if fmt.Sprint(names) != "[alice bob carol]" {
+		t.Fatalf("expected the peers sorted by name, got: %v", names)
+	}
+}
@@ -0,0 +1,181 @@
+package negotiator
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+const (
+	defaultRelayWaitTimeout = 30 * time.Second
+	relayBufferSize         = 32 * 1024
+)
+
+// relayWaiter is a relay request waiting for the other peer of the pair
+type relayWaiter struct {
+	partner chan *session
+	// done is closed once the relayed stream ended
+	done chan struct{}
+}
+
+// handleRelayReq pairs relay requests of two peers that failed to punch through and splices
+// their connections, it reports whether it took over the connection
+func (s *Server) handleRelayReq(sess *session, r *request.RelayRequest) bool {
+	name := string(r.Name())
+	target := string(r.Peer())
+	s.logf("get relay request: from=%v to=%v", name, target)
+
+	// relaying hands the connection over to the stream, a control connection would lose its registration
+	if sess.name != "" {
+		s.logf("relay requested over a control connection: peer=%v", sess.name)
+		sess.fr.WriteFrame(helpers.CreateErrorResponse(peer.ResponseTypeRelay, peer.ErrorCodeBadRequest,
+			"relays need a connection of their own"))
+		return false
+	}
+
+	// relay connections are new connections, the session token proves they belong to a registered peer
+	p, ok := s.registry().Get(name)
+	if !ok || subtle.ConstantTimeCompare(r.SessionToken(), []byte(p.token)) != 1 {
+		s.logf("relay requester is not registered: peer=%v", name)
+		sess.fr.WriteFrame(helpers.CreateErrorResponse(peer.ResponseTypeRelay, peer.ErrorCodeNotRegistered,
+			fmt.Sprintf("requester %v is not registered", name)))
+		return false
+	}
+	if s.ACL != nil && !s.ACL.AllowConnection(name, target) && !s.ACL.AllowConnection(target, name) {
+		s.logf("relay request denied by acl: from=%v to=%v", name, target)
+		sess.fr.WriteFrame(helpers.CreateErrorResponse(peer.ResponseTypeRelay, peer.ErrorCodeForbidden,
+			fmt.Sprintf("%v may not connect to %v", name, target)))
+		return false
+	}
+
+	s.mut.Lock()
+	if w, ok := s.relayWaiting[target+"\x00"+name]; ok {
+		delete(s.relayWaiting, target+"\x00"+name)
+		s.mut.Unlock()
+		w.partner <- sess
+		<-w.done
+		return true
+	}
+	key := name + "\x00" + target
+	if _, ok := s.relayWaiting[key]; ok || s.relaySessions >= s.MaxRelaySessions {
+		s.mut.Unlock()
+		s.logf("relay unavailable: from=%v to=%v sessions=%v", name, target, s.MaxRelaySessions)
+		sess.fr.WriteFrame(helpers.CreateErrorResponse(peer.ResponseTypeRelay, peer.ErrorCodeRelayUnavailable,
+			"relay is unavailable"))
+		return false
+	}
+	w := &relayWaiter{partner: make(chan *session, 1), done: make(chan struct{})}
+	if s.relayWaiting == nil {
+		s.relayWaiting = map[string]*relayWaiter{}
+	}
+	s.relayWaiting[key] = w
+	s.relaySessions++
+	s.mut.Unlock()
+
+	defer func() {
+		s.mut.Lock()
+		s.relaySessions--
+		s.mut.Unlock()
+	}()
+
+	timeout := s.RelayWaitTimeout
+	if timeout == 0 {
+		timeout = defaultRelayWaitTimeout
+	}
+	var other *session
+	select {
+	case other = <-w.partner:
+	case <-time.After(timeout):
+		s.mut.Lock()
+		matched := s.relayWaiting[key] != w
+		delete(s.relayWaiting, key)
+		s.mut.Unlock()
+		if !matched {
+			s.logf("relay peer did not show up: from=%v to=%v", name, target)
+			sess.fr.WriteFrame(helpers.CreateErrorResponse(peer.ResponseTypeRelay, peer.ErrorCodeOffline,
+				fmt.Sprintf("peer %v did not request the relay", target)))
+			return false
+		}
+		// the partner matched while the wait timed out, it is about to hand over its session
+		other = <-w.partner
+	}
+	defer close(w.done)
+
+	if err := sess.fr.WriteFrame(helpers.CreateRelayAccepted()); err != nil {
+		s.logf("failed to accept relay, err: %v", err)
+		return true
+	}
+	if err := other.fr.WriteFrame(helpers.CreateRelayAccepted()); err != nil {
+		s.logf("failed to accept relay, err: %v", err)
+		return true
+	}
+
+	// relayed streams are not heartbeats, they may idle for as long as the peers want, and the
+	// framers' write deadlines do not apply to the stream the framers hand the connections over to
+	sess.con.SetDeadline(time.Time{})
+	other.con.SetDeadline(time.Time{})
+	s.logf("relaying: %v <-> %v", name, target)
+	start := time.Now()
+	var wg sync.WaitGroup
+	var sent, received int64
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent = s.relayCopy(other.con, sess.con)
+	}()
+	go func() {
+		defer wg.Done()
+		received = s.relayCopy(sess.con, other.con)
+	}()
+	wg.Wait()
+	s.logf("relay ended: %v <-> %v, bytes=%v/%v duration=%v", name, target, sent, received, time.Since(start))
+	return true
+}
+
+// relayCopy copies src to dst within the relay bandwidth and returns the bytes copied,
+// when src ends dst is closed for writing so the peer sees the end of the stream
+func (s *Server) relayCopy(dst, src net.Conn) int64 {
+	buf := make([]byte, relayBufferSize)
+	if s.RelayBandwidth > 0 && s.RelayBandwidth < int64(len(buf)) {
+		buf = buf[:s.RelayBandwidth]
+	}
+
+	var total int64
+	start := time.Now()
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				src.Close()
+				return total
+			}
+			total += int64(n)
+			if s.RelayBandwidth > 0 {
+				// sleep until the average rate is back within the bandwidth
+				due := time.Duration(float64(total) / float64(s.RelayBandwidth) * float64(time.Second))
+				if ahead := due - time.Since(start); ahead > 0 {
+					time.Sleep(ahead)
+				}
+			}
+		}
+		if err == io.EOF {
+			if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			} else {
+				dst.Close()
+			}
+			return total
+		}
+		if err != nil {
+			dst.Close()
+			return total
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package negotiator
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// registerForRelay registers name and returns the session token its relay requests present
+func (p *testPeer) registerForRelay(t *testing.T, name string) string {
+	t.Helper()
+	ack := expectStatus(t, p.register(t, &helpers.Registration{Name: name}), peer.RegistrationStatusRegistered)
+	return string(ack.SessionToken())
+}
+
+// requestRelay opens a new connection that asks to be relayed to target
+func requestRelay(t *testing.T, addr, name, token, target string) *testPeer {
+	p := dialPeer(t, addr)
+	p.send(t, helpers.CreateRelayRequest(name, token, target))
+	return p
+}
+
+func expectRelayAccepted(t *testing.T, p *testPeer) {
+	t.Helper()
+	resp := p.read(t)
+	if err := helpers.ResponseErr(resp); err != nil || resp.Type() != peer.ResponseTypeRelay {
+		t.Fatalf("expected the relay to be accepted, got: %v %v", resp.Type(), err)
+	}
+}
+
+// relayPair registers alice and bob and relays a new connection of each to the other
+func relayPair(t *testing.T, addr string) (*testPeer, *testPeer) {
+	aliceToken := dialPeer(t, addr).registerForRelay(t, "alice")
+	bobToken := dialPeer(t, addr).registerForRelay(t, "bob")
+	alice := requestRelay(t, addr, "alice", aliceToken, "bob")
+	bob := requestRelay(t, addr, "bob", bobToken, "alice")
+	expectRelayAccepted(t, alice)
+	expectRelayAccepted(t, bob)
+	return alice, bob
+}
+
+func TestRelaySplicesConnections(t *testing.T) {
+	srv := NewServer(nil)
+	srv.MaxRelaySessions = 1
+	alice, bob := relayPair(t, startServer(t, srv))
+
+	for _, dir := range []struct{ from, to *testPeer }{{alice, bob}, {bob, alice}} {
+		msg := []byte("hello over the relay")
+		if _, err := dir.from.con.Write(msg); err != nil {
+			t.Fatalf("failed to write to the relay, err: %v", err)
+		}
+		got := make([]byte, len(msg))
+		dir.to.con.SetReadDeadline(time.Now().Add(testTimeout))
+		if _, err := io.ReadFull(dir.to.con, got); err != nil || !bytes.Equal(got, msg) {
+			t.Fatalf("expected %q to be relayed, got: %q %v", msg, got, err)
+		}
+	}
+}
+
+func TestRelayBandwidth(t *testing.T) {
+	srv := NewServer(nil)
+	srv.MaxRelaySessions = 1
+	srv.RelayBandwidth = 16 * 1024
+	alice, bob := relayPair(t, startServer(t, srv))
+
+	// the second half of the data is held back until the first one is a second old
+	start := time.Now()
+	go alice.con.Write(make([]byte, 2*srv.RelayBandwidth))
+	bob.con.SetReadDeadline(time.Now().Add(testTimeout))
+	if _, err := io.ReadFull(bob.con, make([]byte, 2*srv.RelayBandwidth)); err != nil {
+		t.Fatalf("failed to read from the relay, err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("expected the relay to take a second at its bandwidth, took: %v", elapsed)
+	}
+}
+
+func TestRelaySessionLimit(t *testing.T) {
+	srv := NewServer(nil)
+	srv.MaxRelaySessions = 1
+	srv.RelayWaitTimeout = time.Second
+	addr := startServer(t, srv)
+	aliceToken := dialPeer(t, addr).registerForRelay(t, "alice")
+	carolToken := dialPeer(t, addr).registerForRelay(t, "carol")
+
+	alice := requestRelay(t, addr, "alice", aliceToken, "bob")
+	// the negotiator reads requests one connection at a time, a round trip makes sure alice's waits
+	alice.con.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := alice.fr.ReadFrame(); err == nil {
+		t.Fatalf("expected alice to wait for bob")
+	}
+	expectCode(t, requestRelay(t, addr, "carol", carolToken, "dave").read(t), peer.ErrorCodeRelayUnavailable)
+}
+
+func TestRelayDisabled(t *testing.T) {
+	addr := startServer(t, NewServer(nil))
+	token := dialPeer(t, addr).registerForRelay(t, "alice")
+	expectCode(t, requestRelay(t, addr, "alice", token, "bob").read(t), peer.ErrorCodeRelayUnavailable)
+}
+
+func TestRelayWaitTimeout(t *testing.T) {
+	srv := NewServer(nil)
+	srv.MaxRelaySessions = 1
+	srv.RelayWaitTimeout = 200 * time.Millisecond
+	addr := startServer(t, srv)
+	token := dialPeer(t, addr).registerForRelay(t, "alice")
+
+	expectCode(t, requestRelay(t, addr, "alice", token, "bob").read(t), peer.ErrorCodeOffline)
+	// the session it waited in is free again
+	expectCode(t, requestRelay(t, addr, "alice", token, "bob").read(t), peer.ErrorCodeOffline)
+}
+
+func TestRelayRequiresRegistration(t *testing.T) {
+	srv := NewServer(nil)
+	srv.MaxRelaySessions = 1
+	addr := startServer(t, srv)
+	dialPeer(t, addr).mustRegister(t, "alice")
+
+	expectCode(t, requestRelay(t, addr, "alice", "wrong", "bob").read(t), peer.ErrorCodeNotRegistered)
+}
+
+func TestRelayRefusesControlConnection(t *testing.T) {
+	srv := NewServer(nil)
+	srv.MaxRelaySessions = 1
+	addr := startServer(t, srv)
+	alice := dialPeer(t, addr)
+	token := alice.registerForRelay(t, "alice")
+
+	alice.send(t, helpers.CreateRelayRequest("alice", token, "bob"))
+	expectCode(t, alice.read(t), peer.ErrorCodeBadRequest)
+
+	// alice is still registered over her control connection
+	carol := dialPeer(t, addr)
+	carol.mustRegister(t, "carol")
+	if got := carol.listNames(t); got != "[alice]" {
+		t.Fatalf("expected alice to stay registered, got: %v", got)
+	}
+}
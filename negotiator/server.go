@@ -0,0 +1,587 @@
+// Package negotiator implements the rendezvous server peers register with
+// and request introductions to other peers through
+package negotiator
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+var ErrServerClosed = errors.New("negotiator: server closed")
+
+const defaultHandshakeTimeout = 10 * time.Second
+
+// writeTimeout bounds writing a single frame to a peer, a peer that stops reading for longer is
+// disconnected rather than left to hold up whoever writes to it
+const writeTimeout = 10 * time.Second
+
+const defaultMaxIntroductions = 16
+
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// Server accepts peer connections and introduces peers to each other
+type Server struct {
+	// Registry stores the registered peers, a MemoryRegistry is used when it is nil
+	Registry Registry
+	// Log receives progress messages, nothing is logged when it is nil
+	Log *log.Logger
+	// DuplicatePolicy decides what happens when a peer registers a name that is already taken
+	DuplicatePolicy DuplicatePolicy
+	// ProbeTimeout bounds the liveness check of a registered peer, defaults to 2 seconds
+	ProbeTimeout time.Duration
+	// Authenticator checks registration credentials, any peer may register when it is nil
+	Authenticator Authenticator
+	// ACL restricts which peers may be introduced to which, all introductions are allowed when it is nil
+	ACL ACL
+	// TLSConfig makes Serve accept TLS connections only, it needs at least one certificate
+	TLSConfig *tls.Config
+	// HandshakeTimeout bounds the TLS handshake of a new connection, defaults to 10 seconds
+	HandshakeTimeout time.Duration
+	// AlternateAddrs are other addresses this server is reachable at, peers compare the address
+	// they are observed from through each of them to discover how their NAT behaves
+	AlternateAddrs []syscall.Sockaddr
+	// MaxRelaySessions bounds how many pairs of peers are relayed at once, relaying is disabled when it is 0
+	MaxRelaySessions int
+	// RelayBandwidth bounds the bytes per second relayed in each direction of a pair, unlimited when 0
+	RelayBandwidth int64
+	// RelayWaitTimeout bounds how long a relay request waits for the other peer, defaults to 30 seconds
+	RelayWaitTimeout time.Duration
+	// HeartbeatTimeout closes peer connections that sent nothing for longer, peers ping to stay
+	// connected, connections are never timed out when it is 0
+	HeartbeatTimeout time.Duration
+	// OfferTimeout bounds how long a peer registered with offers may take to accept a connection,
+	// defaults to 30 seconds
+	OfferTimeout time.Duration
+	// MaxIntroductions bounds how many introductions a peer may have in progress at once,
+	// further connection requests are answered as busy, defaults to 16
+	MaxIntroductions int
+
+	mut       sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	handlers  sync.WaitGroup
+
+	relayWaiting  map[string]*relayWaiter
+	relaySessions int
+
+	subMut      sync.Mutex
+	subscribers map[*session]*subscription
+}
+
+func NewServer(registry Registry) *Server {
+	return &Server{Registry: registry}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	}
+}
+
+func (s *Server) registry() Registry {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.Registry == nil {
+		s.Registry = NewMemoryRegistry()
+	}
+	return s.Registry
+}
+
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if add {
+		if s.closed {
+			return false
+		}
+		if s.listeners == nil {
+			s.listeners = map[net.Listener]struct{}{}
+		}
+		s.listeners[l] = struct{}{}
+	} else {
+		delete(s.listeners, l)
+	}
+	return true
+}
+
+func (s *Server) trackConn(con net.Conn, add bool) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if add {
+		if s.closed {
+			return false
+		}
+		if s.conns == nil {
+			s.conns = map[net.Conn]struct{}{}
+		}
+		s.conns[con] = struct{}{}
+		s.handlers.Add(1)
+	} else {
+		delete(s.conns, con)
+		s.handlers.Done()
+	}
+	return true
+}
+
+// Serve accepts connections on l and handles each of them on its own goroutine,
+// it always returns a non nil error and ErrServerClosed after Shutdown
+func (s *Server) Serve(l net.Listener) error {
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+	s.registry()
+
+	s.logf("ready to accept connections on %v", l.Addr())
+	// tempDelay backs off retrying temporary accept errors, such as running out of descriptors
+	var tempDelay time.Duration
+	for {
+		con, err := l.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = minAcceptDelay
+				} else if tempDelay *= 2; tempDelay > maxAcceptDelay {
+					tempDelay = maxAcceptDelay
+				}
+				s.logf("failed to accept connection, retrying in %v, err: %v", tempDelay, err)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+		s.logf("accepted connection from: %v", con.RemoteAddr())
+
+		if !s.trackConn(con, true) {
+			con.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer s.trackConn(con, false)
+			s.handleConnection(con)
+		}()
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.closed
+}
+
+// Shutdown stops all listeners, closes every peer connection and waits for
+// the connection handlers to return or for ctx to be done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mut.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for con := range s.conns {
+		con.Close()
+	}
+	s.mut.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// session is the state of a single peer connection
+type session struct {
+	con net.Conn
+	fr  *helpers.Framer
+	// peer is the registration made over this connection, if any
+	peer *Peer
+	// name is what the connection authenticated as, the registered peer's or an observer's,
+	// it is empty until then
+	name string
+	// done is closed once the connection is closed
+	done chan struct{}
+
+	mut sync.Mutex
+	// rtt is the smoothed round trip time to the peer, 0 until measured
+	rtt      time.Duration
+	syncs    map[uint64]chan syncEcho
+	nextSync uint64
+	// offers are the connection offers awaiting an answer by session id
+	offers map[string]chan bool
+	// introductions counts the introductions this peer requested that are still in progress
+	introductions int
+}
+
+func (s *Server) handleConnection(con net.Conn) {
+	sess := &session{con: con, fr: helpers.NewFramer(con), done: make(chan struct{})}
+	sess.fr.WriteTimeout = writeTimeout
+	defer s.closeSession(sess)
+
+	if tc, ok := con.(*tls.Conn); ok {
+		timeout := s.HandshakeTimeout
+		if timeout == 0 {
+			timeout = defaultHandshakeTimeout
+		}
+		tc.SetDeadline(time.Now().Add(timeout))
+		if err := tc.Handshake(); err != nil {
+			s.logf("tls handshake with %v failed, err: %v", con.RemoteAddr(), err)
+			return
+		}
+		tc.SetDeadline(time.Time{})
+	}
+	// a misbehaving client must only ever take down its own connection
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("recovered while handling connection with %v, err: %v", con.RemoteAddr(), r)
+		}
+	}()
+
+	for {
+		if s.HeartbeatTimeout > 0 {
+			con.SetReadDeadline(time.Now().Add(s.HeartbeatTimeout))
+		}
+		buf, err := sess.fr.ReadFrame()
+		if err == io.EOF || (err != nil && s.shuttingDown()) {
+			s.logf("connection closed with %v", con.RemoteAddr())
+			return
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			s.logf("no heartbeat from %v in %v, closing the connection", con.RemoteAddr(), s.HeartbeatTimeout)
+			return
+		}
+		if err != nil {
+			s.logf("cannot read from connection with %v, err: %v", con.RemoteAddr(), err)
+			return
+		}
+
+		req, reqTable, err := helpers.ParseRequest(buf)
+		if err != nil {
+			s.logf("dropping connection with %v, err: %v", con.RemoteAddr(), err)
+			return
+		}
+
+		switch req.Type() {
+		case request.RequestTypeRegistration:
+			rr := &request.RegistrationRequest{}
+			rr.Init(reqTable.Bytes, reqTable.Pos)
+			s.handleRegistrationReq(sess, rr)
+		case request.RequestTypeConnection:
+			cr := &request.ConnectionRequest{}
+			cr.Init(reqTable.Bytes, reqTable.Pos)
+			s.handleConnectionReq(sess, cr)
+		case request.RequestTypeBinding:
+			br := &request.BindingRequest{}
+			br.Init(reqTable.Bytes, reqTable.Pos)
+			s.handleBindingReq(sess, br)
+		case request.RequestTypeRelay:
+			rr := &request.RelayRequest{}
+			rr.Init(reqTable.Bytes, reqTable.Pos)
+			if s.handleRelayReq(sess, rr) {
+				return
+			}
+		case request.RequestTypeSync:
+			sr := &request.SyncRequest{}
+			sr.Init(reqTable.Bytes, reqTable.Pos)
+			s.handleSyncReq(sess, sr)
+		case request.RequestTypePing:
+			pr := &request.Ping{}
+			pr.Init(reqTable.Bytes, reqTable.Pos)
+			sess.fr.WriteFrame(helpers.CreatePong(pr.SentAt()))
+		case request.RequestTypeListPeers:
+			lr := &request.ListPeersRequest{}
+			lr.Init(reqTable.Bytes, reqTable.Pos)
+			s.handleListPeersReq(sess, lr)
+		case request.RequestTypeSubscribe:
+			sr := &request.SubscribeRequest{}
+			sr.Init(reqTable.Bytes, reqTable.Pos)
+			s.handleSubscribeReq(sess, sr)
+		case request.RequestTypeOfferReply:
+			or := &request.OfferReply{}
+			or.Init(reqTable.Bytes, reqTable.Pos)
+			s.handleOfferReply(sess, or)
+		}
+	}
+}
+
+// closeSession closes the connection and unregisters the peer it owns
+func (s *Server) closeSession(sess *session) {
+	sess.con.Close()
+	close(sess.done)
+	s.unsubscribe(sess)
+	if sess.peer != nil && s.registry().Remove(sess.peer) {
+		s.logf("removed peer: name=%v", sess.peer.Name)
+		s.notifyPresence(sess.peer, false)
+	}
+}
+
+func (s *Server) handleRegistrationReq(sess *session, r *request.RegistrationRequest) {
+	con := sess.con
+	name := string(r.Name())
+	remoteAddr, err := helpers.StrToSockaddr(con.RemoteAddr().String())
+	if err != nil {
+		s.logf("failed to parse remote address, err: %v", err)
+		return
+	}
+	localAddr := helpers.ReqAddrToSockaddr(r.LocalAddr(&request.Addr{}))
+	s.logf("adding new peer: name=%v local=%v remote=%v", name, helpers.SockaddrToStr(localAddr), con.RemoteAddr())
+
+	if s.Authenticator != nil {
+		cred := helpers.ReqCredential(r.Credential(&request.Credential{}))
+		if err := s.Authenticator.Authenticate(name, r.IdentityKeyBytes(), cred); err != nil {
+			s.logf("rejected registration: name=%v, err: %v", name, err)
+			sess.fr.WriteFrame(helpers.CreateErrorResponse(peer.ResponseTypeRegistration, peer.ErrorCodeUnauthorized,
+				fmt.Sprintf("not authorized to register as %v", name)))
+			return
+		}
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		s.logf("failed to create session token, err: %v", err)
+		return
+	}
+
+	// observers only list and watch peers, the name they authenticated as stays its owner's
+	if r.Observer() {
+		s.release(sess)
+		sess.name = name
+		s.logf("observing peers: name=%v", name)
+		info := &helpers.PeerInfo{Name: name, LocalAddr: localAddr, RemoteAddr: remoteAddr}
+		if err := sess.fr.WriteFrame(helpers.CreateRegistrationAck(info, peer.RegistrationStatusObserving, "")); err != nil {
+			s.logf("failed to send registration details, err: %v", err)
+		}
+		return
+	}
+	p := &Peer{
+		Name:        name,
+		LocalAddr:   localAddr,
+		RemoteAddr:  remoteAddr,
+		IdentityKey: append([]byte{}, r.IdentityKeyBytes()...),
+		Candidates:  peerCandidates(r, localAddr, remoteAddr),
+		NATType:     peer.NATType(r.NatType()),
+		PortDelta:   r.PortDelta(),
+		Hidden:      r.Hidden(),
+		Offers:      r.Offers(),
+		sess:        sess,
+		token:       token,
+	}
+	// the name is claimed before the previous one is released, a refused claim leaves it registered
+	status, code := s.claimName(p, string(r.SessionToken()))
+	if code != peer.ErrorCodeNone {
+		s.logf("rejected registration: name=%v policy=%v code=%v", name, s.DuplicatePolicy, code)
+		msg := fmt.Sprintf("name %v is already registered", name)
+		switch code {
+		case peer.ErrorCodeInvalidSessionToken:
+			msg = fmt.Sprintf("name %v is registered to another session", name)
+		case peer.ErrorCodeOwnerAlive:
+			msg = fmt.Sprintf("name %v is registered to a peer that is still connected", name)
+		}
+		sess.fr.WriteFrame(helpers.CreateErrorResponse(peer.ResponseTypeRegistration, code, msg))
+		return
+	}
+	if sess.peer != nil && sess.peer.Name != name {
+		s.release(sess)
+	}
+	sess.peer, sess.name = p, name
+	s.logf("registered peer: name=%v status=%v nat=%v", name, status, p.NATType)
+
+	err = sess.fr.WriteFrame(helpers.CreateRegistrationAck(p.info(), status, token))
+	if err != nil {
+		s.logf("failed to send registration details, err: %v", err)
+		return
+	}
+	s.notifyPresence(p, true)
+}
+
+// release unregisters the peer of the session, a connection owns a single name so registering
+// again releases the previous one
+func (s *Server) release(sess *session) {
+	if sess.peer != nil && s.registry().Remove(sess.peer) {
+		s.notifyPresence(sess.peer, false)
+	}
+	sess.peer, sess.name = nil, ""
+}
+
+// peerCandidates combines the host candidates a peer registered with the address the
+// negotiator observed, peers cannot claim server reflexive or relay candidates themselves
+func peerCandidates(r *request.RegistrationRequest, localAddr, remoteAddr syscall.Sockaddr) []helpers.Candidate {
+	var cands []helpers.Candidate
+	for _, c := range helpers.ReqCandidates(r) {
+		if c.Type == peer.CandidateTypeHost {
+			cands = append(cands, c)
+		}
+	}
+	if len(cands) == 0 {
+		cands = append(cands, helpers.Candidate{
+			Type:     peer.CandidateTypeHost,
+			Addr:     localAddr,
+			Priority: helpers.CandidatePriority(peer.CandidateTypeHost, 0),
+		})
+	}
+	cands = append(cands, helpers.Candidate{
+		Type:     peer.CandidateTypeServerReflexive,
+		Addr:     remoteAddr,
+		Priority: helpers.CandidatePriority(peer.CandidateTypeServerReflexive, 0),
+	})
+	return helpers.SortCandidates(cands)
+}
+
+func (s *Server) handleConnectionReq(sess *session, r *request.ConnectionRequest) {
+	con := sess.fr
+	requester := string(r.Requester())
+	target := string(r.Peer())
+	requestID := r.RequestId()
+
+	s.logf("get connection request: from=%v to=%v", requester, target)
+
+	// peers can only request introductions for the name registered over their own connection
+	requesterPeer, ok := s.registry().Get(requester)
+	if !ok || requesterPeer != sess.peer {
+		s.logf("requester is not registered: peer=%v", requester)
+		con.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeConnection, requestID, peer.ErrorCodeNotRegistered,
+			fmt.Sprintf("requester %v is not registered", requester)))
+		return
+	}
+
+	if s.ACL != nil && !s.ACL.AllowConnection(requester, target) {
+		s.logf("connection request denied by acl: from=%v to=%v", requester, target)
+		con.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeConnection, requestID, peer.ErrorCodeForbidden,
+			fmt.Sprintf("%v may not connect to %v", requester, target)))
+		return
+	}
+
+	targetPeer, ok := s.registry().Get(target)
+	if !ok {
+		s.logf("target peer does not exist: peer=%v", target)
+		con.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeConnection, requestID, peer.ErrorCodeNotFound,
+			fmt.Sprintf("peer %v was not found", target)))
+		return
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		s.logf("failed to create session id, err: %v", err)
+		return
+	}
+	if !s.startIntroduction(sess) {
+		s.logf("too many introductions in progress: peer=%v", requester)
+		con.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeConnection, requestID, peer.ErrorCodeBusy,
+			"too many connection requests in progress"))
+		return
+	}
+	// measuring the round trip times needs this connection's reads to go on
+	s.handlers.Add(1)
+	go func() {
+		defer s.handlers.Done()
+		defer s.endIntroduction(sess)
+		s.introduce(requesterPeer, targetPeer, requestID, sessionID)
+	}()
+}
+
+// startIntroduction counts an introduction sess requested unless it already has the most
+// in progress it may have
+func (s *Server) startIntroduction(sess *session) bool {
+	max := s.MaxIntroductions
+	if max == 0 {
+		max = defaultMaxIntroductions
+	}
+	sess.mut.Lock()
+	defer sess.mut.Unlock()
+	if sess.introductions >= max {
+		return false
+	}
+	sess.introductions++
+	return true
+}
+
+func (s *Server) endIntroduction(sess *session) {
+	sess.mut.Lock()
+	sess.introductions--
+	sess.mut.Unlock()
+}
+
+// introduce sends both peers each other's details along with start delays that make their
+// connection attempts cross, both introductions carry the same fresh session id, a target
+// registered with offers has to accept the connection before either learns anything
+func (s *Server) introduce(requesterPeer, targetPeer *Peer, requestID uint32, sessionID []byte) {
+	con := requesterPeer.sess.fr
+	requester, target := requesterPeer.Name, targetPeer.Name
+
+	if targetPeer.Offers {
+		if code, msg := s.offer(requesterPeer, targetPeer, sessionID); code != peer.ErrorCodeNone {
+			con.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeConnection, requestID, code, msg))
+			return
+		}
+	}
+
+	// peers behind sequential NATs moved on since they registered, they report a fresh mapping
+	// the other peer predicts their ports from
+	var requesterRTT, targetRTT time.Duration
+	var requesterPort, targetPort int32
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if requesterPeer.PortDelta != 0 {
+			requesterPort = s.sampleMapping(requesterPeer.sess)
+		}
+		requesterRTT = s.measureRTT(requesterPeer.sess)
+	}()
+	go func() {
+		defer wg.Done()
+		if targetPeer.PortDelta != 0 {
+			targetPort = s.sampleMapping(targetPeer.sess)
+		}
+		targetRTT = s.measureRTT(targetPeer.sess)
+	}()
+	wg.Wait()
+	requesterDelay, targetDelay := startDelays(requesterRTT, targetRTT)
+
+	s.logf("sending details to target peer: peer=%v rtt=%v delay=%v", target, targetRTT, targetDelay)
+	err := targetPeer.sess.fr.WriteFrame(helpers.CreateIntroduction(peer.ResponseTypeIntroduction, requesterPeer.info(), sessionID, targetDelay, requesterPort, 0))
+	if err != nil {
+		s.logf("failed to send requester peer details to target peer, err: %v", err)
+		// the target's connection is dead, closing it makes its handler unregister the peer
+		// and tell its subscribers it went offline
+		targetPeer.sess.con.Close()
+		con.WriteFrame(helpers.CreateRequestErrorResponse(peer.ResponseTypeConnection, requestID, peer.ErrorCodeOffline,
+			fmt.Sprintf("peer %v is offline", target)))
+		return
+	}
+
+	s.logf("sending details to requester peer: peer=%v rtt=%v delay=%v", requester, requesterRTT, requesterDelay)
+	err = con.WriteFrame(helpers.CreateIntroduction(peer.ResponseTypeConnection, targetPeer.info(), sessionID, requesterDelay, targetPort, requestID))
+	if err != nil {
+		s.logf("failed to send target peer details to requester, err: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package negotiator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// testTimeout bounds every read of a test peer and the shutdown of a test server
+const testTimeout = 5 * time.Second
+
+// startServer serves srv on a loopback port for the duration of the test
+func startServer(t *testing.T, srv *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, err: %v", err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return l.Addr().String()
+}
+
+// testPeer speaks the wire protocol to the negotiator directly
+type testPeer struct {
+	con net.Conn
+	fr  *helpers.Framer
+}
+
+func dialPeer(t *testing.T, addr string) *testPeer {
+	return dialPeerWith(t, &net.Dialer{}, addr)
+}
+
+func dialPeerWith(t *testing.T, d *net.Dialer, addr string) *testPeer {
+	con, err := d.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect to negotiator, err: %v", err)
+	}
+	t.Cleanup(func() { con.Close() })
+	return &testPeer{con: con, fr: helpers.NewFramer(con)}
+}
+
+func (p *testPeer) send(t *testing.T, frame []byte) {
+	t.Helper()
+	if err := p.fr.WriteFrame(frame); err != nil {
+		t.Fatalf("failed to send request, err: %v", err)
+	}
+}
+
+// read returns the next response the negotiator sent
+func (p *testPeer) read(t *testing.T) *peer.Response {
+	t.Helper()
+	p.con.SetReadDeadline(time.Now().Add(testTimeout))
+	buf, err := p.fr.ReadFrame()
+	if err != nil {
+		t.Fatalf("failed to read response, err: %v", err)
+	}
+	resp, err := helpers.ParseResponse(buf)
+	if err != nil {
+		t.Fatalf("failed to parse response, err: %v", err)
+	}
+	return resp
+}
+
+// register sends reg from the peer's own address and returns the negotiator's answer
+func (p *testPeer) register(t *testing.T, reg *helpers.Registration) *peer.Response {
+	t.Helper()
+	local := p.con.LocalAddr().(*net.TCPAddr)
+	reg.LocalAddr = helpers.IPToSockaddr(local.IP, local.Port)
+	p.send(t, helpers.CreateRegistrationReq(reg))
+	return p.read(t)
+}
+
+// mustRegister registers name and fails the test unless the negotiator acknowledges it
+func (p *testPeer) mustRegister(t *testing.T, name string) {
+	t.Helper()
+	if err := helpers.ResponseErr(p.register(t, &helpers.Registration{Name: name})); err != nil {
+		t.Fatalf("failed to register %v, err: %v", name, err)
+	}
+}
+
+func TestIntroductionsPerPeerAreBounded(t *testing.T) {
+	srv := NewServer(nil)
+	srv.MaxIntroductions = 2
+	srv.OfferTimeout = 300 * time.Millisecond
+	addr := startServer(t, srv)
+
+	// bob has every connection offered to him and never answers, which keeps the introductions going
+	bob := dialPeer(t, addr)
+	if err := helpers.ResponseErr(bob.register(t, &helpers.Registration{Name: "bob", Offers: true})); err != nil {
+		t.Fatalf("failed to register bob, err: %v", err)
+	}
+	alice := dialPeer(t, addr)
+	alice.mustRegister(t, "alice")
+
+	for id := uint32(1); id <= 3; id++ {
+		alice.send(t, helpers.CreateConnectionRequest("bob", "alice", id))
+	}
+	resp := alice.read(t)
+	if resp.RequestId() != 3 {
+		t.Fatalf("expected the request beyond the bound to be answered first, got: %v", resp.RequestId())
+	}
+	expectCode(t, resp, peer.ErrorCodeBusy)
+	for i := 0; i < 2; i++ {
+		expectCode(t, alice.read(t), peer.ErrorCodeDeclined)
+	}
+
+	// the finished introductions make room for new ones
+	alice.send(t, helpers.CreateConnectionRequest("bob", "alice", 4))
+	expectCode(t, alice.read(t), peer.ErrorCodeDeclined)
+}
+
+func TestDisconnectUnregistersPeer(t *testing.T) {
+	srv := NewServer(nil)
+	addr := startServer(t, srv)
+	alice := dialPeer(t, addr)
+	alice.mustRegister(t, "alice")
+	bob := dialPeer(t, addr)
+	bob.mustRegister(t, "bob")
+	if names := alice.listNames(t); names != "[bob]" {
+		t.Fatalf("expected bob to be listed, got: %v", names)
+	}
+
+	bob.con.Close()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		if _, ok := srv.registry().Get("bob"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bob is still registered after disconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if names := alice.listNames(t); names != "[]" {
+		t.Fatalf("expected nobody to be listed, got: %v", names)
+	}
+	alice.send(t, helpers.CreateConnectionRequest("bob", "alice", 1))
+	expectCode(t, alice.read(t), peer.ErrorCodeNotFound)
+
+	// the name is free to register again
+	dialPeer(t, addr).mustRegister(t, "bob")
+}
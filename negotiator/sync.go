@@ -0,0 +1,128 @@
+package negotiator
+
+import (
+	"crypto/rand"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/request"
+)
+
+const (
+	syncTimeout = time.Second
+	// sampleTimeout bounds a sync that asks for a sample, which takes a connection to the negotiator
+	sampleTimeout = 3 * time.Second
+	// startMargin is added to the start delays so both peers have their sockets ready in time
+	startMargin = 100 * time.Millisecond
+)
+
+// measureRTT sends a sync to the peer and waits for its echo, it returns the smoothed round
+// trip time of the session, which stays the previous estimate when the echo is late
+func (s *Server) measureRTT(sess *session) time.Duration {
+	if sample, ok := s.sync(sess, syncTimeout); ok {
+		sess.updateRTT(sample)
+	}
+
+	sess.mut.Lock()
+	defer sess.mut.Unlock()
+	return sess.rtt
+}
+
+// sync sends a sync to the peer and waits up to timeout for its echo, it returns the round
+// trip time and whether the echo arrived
+func (s *Server) sync(sess *session, timeout time.Duration) (time.Duration, bool) {
+	rtt, _, ok := s.exchangeSync(sess, timeout, false)
+	return rtt, ok
+}
+
+// sampleMapping asks a peer behind a sequential NAT for a mapping made right now, its next
+// mappings follow it so peers predict from it, it returns 0 when the peer could not sample
+func (s *Server) sampleMapping(sess *session) int32 {
+	_, port, ok := s.exchangeSync(sess, sampleTimeout, true)
+	if !ok || port == 0 {
+		s.logf("no fresh mapping sampled from %v", sess.con.RemoteAddr())
+		return 0
+	}
+	return port
+}
+
+func (s *Server) exchangeSync(sess *session, timeout time.Duration, sample bool) (time.Duration, int32, bool) {
+	echo := make(chan syncEcho, 1)
+	sess.mut.Lock()
+	sess.nextSync++
+	nonce := sess.nextSync
+	if sess.syncs == nil {
+		sess.syncs = map[uint64]chan syncEcho{}
+	}
+	sess.syncs[nonce] = echo
+	sess.mut.Unlock()
+	defer func() {
+		sess.mut.Lock()
+		delete(sess.syncs, nonce)
+		sess.mut.Unlock()
+	}()
+
+	sent := time.Now()
+	if err := sess.fr.WriteFrame(helpers.CreateSync(nonce, sample)); err != nil {
+		s.logf("failed to send sync, err: %v", err)
+		return 0, 0, false
+	}
+	select {
+	case e := <-echo:
+		return e.arrived.Sub(sent), e.mappedPort, true
+	case <-time.After(timeout):
+		s.logf("sync to %v timed out", sess.con.RemoteAddr())
+	case <-sess.done:
+	}
+	return 0, 0, false
+}
+
+// syncEcho is when the echo of a sync arrived and the mapped port it reported
+type syncEcho struct {
+	arrived    time.Time
+	mappedPort int32
+}
+
+func (s *Server) handleSyncReq(sess *session, r *request.SyncRequest) {
+	arrived := time.Now()
+	sess.mut.Lock()
+	echo, ok := sess.syncs[r.Nonce()]
+	sess.mut.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case echo <- syncEcho{arrived: arrived, mappedPort: r.MappedPort()}:
+	default:
+	}
+}
+
+// updateRTT folds a round trip sample into the smoothed estimate the way RFC 6298 does
+func (sess *session) updateRTT(sample time.Duration) {
+	sess.mut.Lock()
+	defer sess.mut.Unlock()
+	if sess.rtt == 0 {
+		sess.rtt = sample
+		return
+	}
+	sess.rtt = sess.rtt*7/8 + sample/8
+}
+
+// startDelays schedules both peers of an introduction to start connecting at the same moment,
+// an introduction reaches its peer about half a round trip after it is sent
+func startDelays(rttA, rttB time.Duration) (time.Duration, time.Duration) {
+	lead := rttA / 2
+	if rttB/2 > lead {
+		lead = rttB / 2
+	}
+	lead += startMargin
+	return lead - rttA/2, lead - rttB/2
+}
+
+func newSessionID() ([]byte, error) {
+	b := make([]byte, helpers.SessionIDSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,103 @@
+package negotiator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateRTT(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		samples []time.Duration
+		want    time.Duration
+	}{
+		{
+			name:    "first sample is taken as is",
+			samples: []time.Duration{80 * time.Millisecond},
+			want:    80 * time.Millisecond,
+		},
+		{
+			name:    "later sample weighs an eighth",
+			samples: []time.Duration{80 * time.Millisecond, 160 * time.Millisecond},
+			want:    90 * time.Millisecond,
+		},
+		{
+			name:    "faster sample",
+			samples: []time.Duration{80 * time.Millisecond, 0},
+			want:    70 * time.Millisecond,
+		},
+		{
+			name:    "steady samples",
+			samples: []time.Duration{40 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond},
+			want:    40 * time.Millisecond,
+		},
+		{
+			name:    "samples accumulate",
+			samples: []time.Duration{64 * time.Millisecond, 128 * time.Millisecond, 128 * time.Millisecond},
+			want:    79 * time.Millisecond,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sess := &session{}
+			for _, sample := range test.samples {
+				sess.updateRTT(sample)
+			}
+			if sess.rtt != test.want {
+				t.Fatalf("expected %v, got: %v", test.want, sess.rtt)
+			}
+		})
+	}
+}
+
+func TestStartDelays(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		rttA, rttB   time.Duration
+		wantA, wantB time.Duration
+	}{
+		{
+			name:  "no round trips measured",
+			wantA: startMargin,
+			wantB: startMargin,
+		},
+		{
+			name:  "equal round trips",
+			rttA:  60 * time.Millisecond,
+			rttB:  60 * time.Millisecond,
+			wantA: startMargin,
+			wantB: startMargin,
+		},
+		{
+			name:  "farther first peer",
+			rttA:  300 * time.Millisecond,
+			rttB:  100 * time.Millisecond,
+			wantA: startMargin,
+			wantB: startMargin + 100*time.Millisecond,
+		},
+		{
+			name:  "farther second peer",
+			rttA:  20 * time.Millisecond,
+			rttB:  220 * time.Millisecond,
+			wantA: startMargin + 100*time.Millisecond,
+			wantB: startMargin,
+		},
+		{
+			name:  "one round trip measured",
+			rttA:  0,
+			rttB:  80 * time.Millisecond,
+			wantA: startMargin + 40*time.Millisecond,
+			wantB: startMargin,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := startDelays(test.rttA, test.rttB)
+			if a != test.wantA || b != test.wantB {
+				t.Fatalf("expected %v %v, got: %v %v", test.wantA, test.wantB, a, b)
+			}
+			// both introductions arrive and start at the same moment
+			if test.rttA/2+a != test.rttB/2+b {
+				t.Fatalf("expected the peers to start together, got: %v %v", test.rttA/2+a, test.rttB/2+b)
+			}
+		})
+	}
+}
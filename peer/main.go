@@ -1,226 +1,249 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"log"
 	"net"
 	"os"
-	"syscall"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
 	. "github.com/arckey/tcp-punchthrough/helpers"
-	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/punch"
 )
 
 var sAddrFlag = flag.String("negotiator-addr", "", "the address of the negotiator server")
-var peerNameFlag = flag.String("name", "", "the peer name, other peers will use it to connect to you")
+var peerNameFlag = flag.String("name", "", "the peer name, other peers will use it to connect to you, list and watch only authenticate with it")
 var targetNameFlag = flag.String("target", "", "the name of the target peer you want to connect to")
+var tokenFlag = flag.String("token", "", "a bearer token to register with")
+var secretFlag = flag.String("secret", "", "a pre-shared secret to sign the registration with")
+var tlsFlag = flag.Bool("tls", false, "connect to the negotiator over TLS")
+var tlsCAFlag = flag.String("tls-ca", "", "a PEM file of CAs to verify the negotiator with instead of the system roots, implies --tls")
+var tlsServerNameFlag = flag.String("tls-server-name", "", "the name to verify the negotiator certificate against, defaults to its host")
+var tlsCertFlag = flag.String("tls-cert", "", "a PEM client certificate for negotiators requiring mTLS, implies --tls")
+var tlsKeyFlag = flag.String("tls-key", "", "the PEM private key of --tls-cert")
+var sessionTokenFlag = flag.String("session-token", "", "the session token of an earlier registration, used to take over its name")
+var identityKeyFlag = flag.String("identity-key", "", "a PEM ed25519 key file identifying this peer, created if it does not exist")
+var interfacesFlag = flag.String("interfaces", "", "comma separated patterns of the interfaces offered to peers as host candidates, e.g. eth*,wlan0, all when empty")
+var excludeInterfacesFlag = flag.String("exclude-interfaces", "", "comma separated patterns of interfaces never offered to peers, e.g. tun*,docker*")
+var detectNATFlag = flag.Bool("detect-nat", false, "discover the NAT type before registering, the negotiator needs --alt-addr for more than open or not")
+var portPredictionFlag = flag.Bool("port-prediction", false, "sample how the NAT allocates ports and try predicted ports of peers behind sequential NATs")
+var predictionWindowFlag = flag.Int("prediction-window", 8, "how many predicted ports of a peer to try")
+var predictionSocketsFlag = flag.Int("prediction-sockets", 32, "the most sockets opened for predicted ports of a peer")
+var relayFlag = flag.Bool("relay", false, "fall back to a connection relayed by the negotiator when punching through fails")
+var relayAfterFlag = flag.Duration("relay-after", 15*time.Second, "how long to try punching through before falling back to the relay")
+var retriesFlag = flag.Int("retries", 3, "how many sockets every peer candidate is tried with")
+var retryDelayFlag = flag.Duration("retry-delay", 2*time.Second, "the wait before retrying a candidate, doubled for every further retry")
+var maxRetryDelayFlag = flag.Duration("max-retry-delay", 30*time.Second, "the longest wait between retries of a candidate")
+var retryJitterFlag = flag.Float64("retry-jitter", 0.2, "the fraction retry delays are randomized by")
+var attemptTimeoutFlag = flag.Duration("attempt-timeout", 10*time.Second, "how long a single connect try may take")
+var dialTimeoutFlag = flag.Duration("dial-timeout", 60*time.Second, "how long punching through to a peer may take")
+var backlogFlag = flag.Int("backlog", 10, "the listen backlog of the socket accepting peers")
+var startDelayFlag = flag.Duration("start-delay", time.Second, "how long to wait before connecting when the negotiator did not schedule the start")
+var heartbeatIntervalFlag = flag.Duration("heartbeat-interval", 15*time.Second, "how often the negotiator connection is pinged, negative disables heartbeats")
+var heartbeatTimeoutFlag = flag.Duration("heartbeat-timeout", 0, "how long the negotiator may stay silent before reconnecting, defaults to three heartbeat intervals")
+var maxReconnectDelayFlag = flag.Duration("max-reconnect-delay", time.Minute, "the longest wait between tries to reconnect to the negotiator")
+var hiddenFlag = flag.Bool("hidden", false, "leave this peer out of the peer lists of others, it can still be connected to by name")
+var allowFlag = flag.String("allow", "", "comma separated name patterns of peers whose connections are accepted, e.g. alice,team-*, others are declined unless --prompt")
+var promptFlag = flag.Bool("prompt", false, "ask on the terminal before accepting a connection from a peer not in --allow")
+var secureFlag = flag.Bool("secure", false, "encrypt peer connections and verify peers against their registered identity key, requires --identity-key")
 
 const (
-	connectRetries       = 3
-	connectRetryDelay    = 2000 * time.Millisecond
-	establishConnTimeout = 300 * time.Second
+	// listCmd prints the registered peers instead of connecting
+	listCmd = "list"
+	// watchCmd prints when the named peers come online or go offline
+	watchCmd = "watch"
 )
 
-var localPort int
+var commands = map[string]bool{listCmd: true, watchCmd: true}
 
 func main() {
-	validateFlags()
-
-	sock := connectToNegotiatorServer()
+	cmd, args := validateFlags()
+	ctx := context.Background()
+	var err error
+
+	client := punch.NewClient(*sAddrFlag)
+	client.Log = log.New(os.Stdout, "", 0)
+	client.SessionToken = *sessionTokenFlag
+	client.Token = *tokenFlag
+	client.Secret = []byte(*secretFlag)
+	client.TLSConfig, err = tlsConfig()
+	PanicIfErr("failed to load tls configuration", err)
+	client.Secure = *secureFlag
+	client.AllowInterfaces = splitList(*interfacesFlag)
+	client.DenyInterfaces = splitList(*excludeInterfacesFlag)
+	client.DiscoverNAT = *detectNATFlag
+	client.PortPrediction = *portPredictionFlag
+	client.PredictionWindow = *predictionWindowFlag
+	client.MaxPredictionSockets = *predictionSocketsFlag
+	client.Relay = *relayFlag
+	client.RelayAfter = *relayAfterFlag
+	client.DialOptions = punch.DialOptions{
+		Retries:        *retriesFlag,
+		RetryDelay:     *retryDelayFlag,
+		MaxRetryDelay:  *maxRetryDelayFlag,
+		Jitter:         *retryJitterFlag,
+		AttemptTimeout: *attemptTimeoutFlag,
+		Timeout:        *dialTimeoutFlag,
+		Backlog:        *backlogFlag,
+		StartDelay:     *startDelayFlag,
+	}
+	client.HeartbeatInterval = *heartbeatIntervalFlag
+	client.HeartbeatTimeout = *heartbeatTimeoutFlag
+	client.MaxReconnectDelay = *maxReconnectDelayFlag
+	client.Hidden = *hiddenFlag
+	// list and watch only look around, the name may be in use by this user's own peer
+	client.Observer = cmd == listCmd || cmd == watchCmd
+	if *allowFlag != "" || *promptFlag {
+		client.AllowPeer = allowPeer(splitList(*allowFlag), *promptFlag)
+	}
+	if *identityKeyFlag != "" {
+		client.Identity, err = punch.LoadOrCreateIdentity(*identityKeyFlag)
+		PanicIfErr("failed to load identity key", err)
+		fmt.Printf("identity: %v\n", punch.Fingerprint(client.Identity.Public().(ed25519.PublicKey)))
+	}
+	err = client.Register(ctx, *peerNameFlag)
+	PanicIfErr("failed to register to negotiator", err)
+	if !client.Observer {
+		fmt.Printf("session token: %v\n", client.SessionToken)
+	}
+	if *detectNATFlag {
+		fmt.Printf("nat type: %v\n", client.NATType())
+	}
 
-	if *targetNameFlag == "" {
-		acceptIncommingPeer(sock)
-	} else {
-		p := requestPeer(sock, *targetNameFlag)
-		s := establishConnectionToPeer(p)
-		if s == -1 {
-			panic(fmt.Errorf("failed to establish connection to peer"))
+	if cmd == listCmd {
+		prefix := ""
+		if len(args) > 0 {
+			prefix = args[0]
 		}
-		chatWithPeer(s, p)
+		listPeers(ctx, client, prefix)
+	} else if cmd == watchCmd {
+		watchPeers(ctx, client, args)
+	} else if *targetNameFlag == "" {
+		acceptIncommingPeer(ctx, client)
+	} else {
+		con, err := client.Dial(ctx, *targetNameFlag)
+		PanicIfErr("failed to establish connection to peer", err)
+		chatWithPeer(con)
 	}
 }
 
-func chatWithPeer(sock int, p *peer.Peer) {
-	buf := make([]byte, 256)
-	pname := string(p.Name())
-	fmt.Printf("connected to: %v, sock=%v\n", pname, sock)
+func listPeers(ctx context.Context, client *punch.Client, prefix string) {
+	after := ""
 	for {
-		fmt.Printf("[msg:] ")
-		n, err := os.Stdin.Read(buf)
-		PanicIfErr("failed to read message from stdin", err)
-
-		n, err = syscall.Write(sock, buf[:n])
-		PanicIfErr("failed to write message", err)
-
-		n, err = syscall.Read(sock, buf)
-		PanicIfErr("failed to read response from peer", err)
-
-		fmt.Printf("[resp:] %v", string(buf[0:n]))
+		peers, next, err := client.ListPeers(ctx, prefix, after, 0)
+		PanicIfErr("failed to list peers", err)
+		for _, p := range peers {
+			identity := "none"
+			if len(p.IdentityKey) > 0 {
+				identity = punch.Fingerprint(ed25519.PublicKey(p.IdentityKey))
+			}
+			fmt.Printf("%v nat=%v identity=%v\n", p.Name, p.NATType, identity)
+		}
+		if next == "" {
+			return
+		}
+		after = next
 	}
 }
 
-func establishConnectionToPeer(p *peer.Peer) int {
-	fmt.Printf("trying to establish connection to: %v\n", string(p.Name()))
-	acceptChan := make(chan int)
-	connectLocalChan := make(chan int)
-	connectRemoteChan := make(chan int)
-
-	pname := string(p.Name())
-	remoteAddr := PeerAddrToAddrV4(p.RemoteAddr(&peer.Addr{}))
-	localAddr := PeerAddrToAddrV4(p.LocalAddr(&peer.Addr{}))
-
-	go attemptAccept(acceptChan)
-	time.Sleep(time.Second * 1) // wait one second
-	go attemptConnect(localAddr, connectLocalChan)
-	go attemptConnect(remoteAddr, connectRemoteChan)
-
-	failures := 0
-	tout := time.After(establishConnTimeout)
-	for failures != 3 {
-		select {
-		case sock := <-acceptChan:
-			return sock
-		case sock := <-connectLocalChan:
-			return sock
-		case sock := <-connectRemoteChan:
-			return sock
-		case <-tout:
-			fmt.Println("timeout reached")
-			return -1
+func watchPeers(ctx context.Context, client *punch.Client, names []string) {
+	events := client.Presence()
+	err := client.Subscribe(ctx, names...)
+	PanicIfErr("failed to subscribe", err)
+	fmt.Printf("watching: %v\n", strings.Join(names, " "))
+	for ev := range events {
+		state := "offline"
+		if ev.Online {
+			state = "online"
 		}
+		fmt.Printf("%v is %v, nat=%v\n", ev.Peer.Name, state, ev.Peer.NATType)
 	}
-
-	fmt.Printf("all attempts to connect to: %v have failed\n", pname)
-	return -1
-}
-
-func makeSock(localPort int) int {
-	sock, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, syscall.IPPROTO_IP)
-	PanicIfErr("failed to create socket", err)
-
-	err = ConfigureSocket(sock)
-	PanicIfErr("failed to configure socket", err)
-
-	err = syscall.Bind(sock, &syscall.SockaddrInet4{Port: localPort})
-	PanicIfErr("failed to bind socket", err)
-
-	return sock
 }
 
-func attemptConnect(addr *syscall.SockaddrInet4, res chan int) {
-	conChan := make(chan int)
-	socks := make([]int, connectRetries)
-
-	for i := range socks {
-		sock := makeSock(localPort)
-		fmt.Printf("creating socket: sock=%v\n", sock)
-		socks[i] = sock
-	}
-
-	tryAgain := func(addr *syscall.SockaddrInet4, res chan int, try, sock int) {
-		fmt.Printf("attempting to connect to %v:%v retry=%v sock=%v\n", addr.Addr, addr.Port, try, sock)
-		if err := syscall.Connect(sock, addr); err != nil {
-			fmt.Printf("failed to connect to %v:%v, retry=%v, err=%v\n", addr.Addr, addr.Port, try, err)
-		} else {
-			fmt.Printf("succefully connected to %v:%v\n", addr.Addr, addr.Port)
-			res <- sock
-			return
+// allowPeer accepts the peers matching allow and asks about the rest if prompt is set
+func allowPeer(allow []string, prompt bool) func(PeerEntry) bool {
+	var mut sync.Mutex
+	stdin := bufio.NewReader(os.Stdin)
+	return func(requester PeerEntry) bool {
+		for _, pattern := range allow {
+			if ok, _ := path.Match(pattern, requester.Name); ok {
+				return true
+			}
+		}
+		if !prompt {
+			fmt.Printf("declining connection from: %v\n", requester.Name)
+			return false
 		}
-	}
-
-	go tryAgain(addr, conChan, 0, socks[0])
 
-	for i := 1; i < connectRetries; i++ {
-		tagain := time.After(connectRetryDelay)
-		select {
-		case successSock := <-conChan:
-			res <- successSock
-			return
-		case <-tagain:
-			go tryAgain(addr, conChan, i, socks[i])
+		// one question at a time, answers are read from the same terminal
+		mut.Lock()
+		defer mut.Unlock()
+		identity := "none"
+		if len(requester.IdentityKey) > 0 {
+			identity = punch.Fingerprint(ed25519.PublicKey(requester.IdentityKey))
 		}
+		fmt.Printf("accept connection from %v, identity=%v? [y/N] ", requester.Name, identity)
+		answer, err := stdin.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
 	}
 }
 
-func attemptAccept(res chan int) {
-	sock, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, syscall.IPPROTO_IP)
-	PanicIfErr("failed to create socket", err)
-
-	err = ConfigureSocket(sock)
-	PanicIfErr("failed to configure socket", err)
-
-	sa := &syscall.SockaddrInet4{Port: localPort}
-	copy(sa.Addr[:], net.ParseIP("0.0.0.0"))
-	err = syscall.Bind(sock, sa)
-	PanicIfErr("failed to bind socket", err)
-
-	err = syscall.Listen(sock, 10)
-	PanicIfErr("failed to listen with socket", err)
+func chatWithPeer(con net.Conn) {
+	buf := make([]byte, 256)
+	pc := con.(*punch.Conn)
+	pname := pc.PeerName()
+	fmt.Printf("connected to: %v, addr=%v path=%v secure=%v\n", pname, con.RemoteAddr(), pc.Path(), pc.Secure())
+	for {
+		fmt.Printf("[msg:] ")
+		n, err := os.Stdin.Read(buf)
+		PanicIfErr("failed to read message from stdin", err)
 
-	fmt.Printf("listening for incomming connections on port %v, sock=%v\n", localPort, sock)
-	peerSock, peerAddr, err := syscall.Accept(sock)
-	if err != nil {
-		fmt.Printf("failed to accept connection, err: %v\n", err)
-		return
-	}
-	peerAddrV4, _ := peerAddr.(*syscall.SockaddrInet4)
-	fmt.Printf("accepted connection from: %v:%v\n", peerAddrV4.Addr, peerAddrV4.Port)
-	res <- peerSock
-}
+		n, err = con.Write(buf[:n])
+		PanicIfErr("failed to write message", err)
 
-func requestPeer(sock int, targetPeer string) *peer.Peer {
-	buf := make([]byte, 512)
-	cr := CreateConnectionRequest(targetPeer, *peerNameFlag)
-	_, err := syscall.Write(sock, cr)
-	PanicIfErr("failed to send connection request", err)
+		n, err = con.Read(buf)
+		PanicIfErr("failed to read response from peer", err)
 
-	n, err := syscall.Read(sock, buf)
-	PanicIfErr("failed to read peer from server", err)
-	if n == 1 && buf[0] == 1 {
-		panic(fmt.Errorf("peer with name %v was not found", targetPeer))
+		fmt.Printf("[resp:] %v", string(buf[0:n]))
 	}
-
-	return peer.GetRootAsPeer(buf[:n], 0)
 }
 
-func acceptIncommingPeer(sock int) {
-	buf := make([]byte, 512)
+func acceptIncommingPeer(ctx context.Context, client *punch.Client) {
 	fmt.Println("waiting for incomming peer requests")
 	for {
-		n, err := syscall.Read(sock, buf)
-		PanicIfErr("failed to read from negotiator server", err)
-
-		other := peer.GetRootAsPeer(buf[:n], 0)
-		name := string(other.Name())
-		remoteAddr := other.RemoteAddr(&peer.Addr{})
-		localAddr := other.LocalAddr(&peer.Addr{})
-		fmt.Printf("got connection request from: name=%v local=%v remote=%v\n",
-			name,
-			PeerAddrToStr(localAddr),
-			PeerAddrToStr(remoteAddr))
-		peerSock := establishConnectionToPeer(other)
-		if peerSock == -1 {
-			panic(fmt.Errorf("failed to establish connection to peer"))
-		}
-		go handlePeerConnection(peerSock, other)
+		con, err := client.Accept(ctx)
+		PanicIfErr("failed to establish connection to peer", err)
+		go handlePeerConnection(con)
 	}
 }
 
-func handlePeerConnection(peerSock int, p *peer.Peer) {
+func handlePeerConnection(con net.Conn) {
+	defer con.Close()
 	buf := make([]byte, 512)
-	pname := string(p.Name())
+	pname := con.(*punch.Conn).PeerName()
 
 	// echo server
 	for {
-		n, err := syscall.Read(peerSock, buf)
+		n, err := con.Read(buf)
 		if err != nil {
 			fmt.Printf("failed to read from peer: %v, err: %v\n", pname, err)
 			return
 		}
 
 		fmt.Printf("[%v:] %v\n", pname, string(buf[:n]))
-		_, err = syscall.Write(peerSock, buf[:n])
+		_, err = con.Write(buf[:n])
 		if err != nil {
 			fmt.Printf("failed to respond to peer: %v, err: %v\n", pname, err)
 			return
@@ -228,46 +251,64 @@ func handlePeerConnection(peerSock int, p *peer.Peer) {
 	}
 }
 
-func connectToNegotiatorServer() int {
-	buf := make([]byte, 512)
-	sock, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, syscall.IPPROTO_IP)
-	PanicIfErr("failed to create socket", err)
-
-	err = ConfigureSocket(sock)
-	PanicIfErr("failed to configure socket", err)
-
-	err = syscall.Bind(sock, &syscall.SockaddrInet4{})
-	PanicIfErr("failed to bind socket", err)
-
-	laddr, err := syscall.Getsockname(sock)
-	PanicIfErr("failed to get local address", err)
-	laddrv4 := laddr.(*syscall.SockaddrInet4)
-	localPort = laddrv4.Port
-
-	sAddr, err := StrToAddrV4(*sAddrFlag)
-	PanicIfErr("failed to parse negotiator address", err)
-
-	err = syscall.Connect(sock, sAddr)
-	PanicIfErr("failed to connect to negotiator server", err)
-	fmt.Printf("connected to negotiator server using local address: %v:%v\n", laddrv4.Addr, laddrv4.Port)
-
-	req := CreateRegistrationReq(*peerNameFlag, laddrv4)
-	_, err = syscall.Write(sock, req)
-	PanicIfErr("failed to register to negotiator", err)
-	fmt.Printf("registered as: %v, %v:%v\n", *peerNameFlag, laddrv4.Addr, laddrv4.Port)
-
-	n, err := syscall.Read(sock, buf)
-	PanicIfErr("failed to read from negotiator server", err)
+func tlsConfig() (*tls.Config, error) {
+	if !*tlsFlag && *tlsCAFlag == "" && *tlsCertFlag == "" {
+		return nil, nil
+	}
 
-	me := peer.GetRootAsPeer(buf[:n], 0)
-	remoteAddr := me.RemoteAddr(&peer.Addr{})
-	fmt.Printf("recognized as: %v\n", PeerAddrToStr(remoteAddr))
+	cfg := &tls.Config{
+		ServerName: *tlsServerNameFlag,
+		MinVersion: tls.VersionTLS12,
+	}
+	if *tlsCAFlag != "" {
+		pool, err := LoadCertPool(*tlsCAFlag)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if *tlsCertFlag != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCertFlag, *tlsKeyFlag)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
 
-	return sock
+func splitList(list string) []string {
+	var res []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
 }
 
-func validateFlags() {
-	flag.Parse()
+// validateFlags parses the flags and returns the subcommand and its arguments,
+// the subcommand may come before or after the flags
+func validateFlags() (string, []string) {
+	args := os.Args[1:]
+	cmd := ""
+	if len(args) > 0 && commands[args[0]] {
+		cmd, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	args = flag.Args()
+	if cmd == "" && len(args) > 0 && commands[args[0]] {
+		cmd, args = args[0], args[1:]
+	}
+	switch {
+	case cmd == "" && len(args) > 0:
+		panic(fmt.Errorf("unknown subcommand: %v", args[0]))
+	case cmd == listCmd && len(args) > 1:
+		panic("list takes at most a name prefix")
+	case cmd == watchCmd && len(args) == 0:
+		panic("watch takes the names or patterns of the peers to watch")
+	}
+
 	if *sAddrFlag == "" {
 		panic("--negotiator-addr flag is required")
 	}
@@ -275,4 +316,25 @@ func validateFlags() {
 	if *peerNameFlag == "" {
 		panic("--name flag is required")
 	}
+
+	if *secureFlag && *identityKeyFlag == "" {
+		panic("--secure requires --identity-key")
+	}
+
+	if *retryJitterFlag < 0 || *retryJitterFlag > 1 {
+		panic("--retry-jitter must be between 0 and 1")
+	}
+
+	for _, pattern := range append(splitList(*interfacesFlag), splitList(*excludeInterfacesFlag)...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Errorf("bad interface pattern %v, err: %v", pattern, err))
+		}
+	}
+
+	for _, pattern := range splitList(*allowFlag) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Errorf("bad allow pattern %v, err: %v", pattern, err))
+		}
+	}
+	return cmd, args
 }
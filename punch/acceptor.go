@@ -0,0 +1,158 @@
+package punch
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+)
+
+// acceptHelloTimeout bounds how long an accepted connection may take to send its hello
+const acceptHelloTimeout = 5 * time.Second
+
+// acceptor is the one listener of a client on its port, with SO_REUSEPORT every punch listening
+// on its own would have the kernel split the incoming connections between them, so all punches
+// from the port share it and accepted connections go to the punch whose session their hello names
+type acceptor struct {
+	key acceptorKey
+	l   net.Listener
+	// attempts are the punches in progress by session id
+	attempts map[string]*attempts
+	// pending are the accepted connections whose hello was not read yet
+	pending map[net.Conn]struct{}
+	// routing counts the connections being routed, done is closed once the accept loop returned
+	routing sync.WaitGroup
+	done    chan struct{}
+}
+
+// acceptorKey is the socket family and local port an acceptor listens on, a reconnect may move
+// the client to another port while punches from the previous one are still in progress
+type acceptorKey struct {
+	family, port int
+}
+
+// attemptAccept has the connections the peer opens routed to the attempt until punching ends
+func (c *Client) attemptAccept(a *attempts) {
+	defer a.wg.Done()
+	if err := c.joinAcceptor(a); err != nil {
+		c.logf("failed to listen for the peer, err: %v", err)
+		return
+	}
+	<-a.done
+	c.leaveAcceptor(a)
+}
+
+// joinAcceptor registers the attempt with the acceptor of its port, listening on the port if no
+// other punch from it is in progress, the first punch decides the backlog
+func (c *Client) joinAcceptor(a *attempts) error {
+	c.acceptMut.Lock()
+	defer c.acceptMut.Unlock()
+	key := acceptorKey{family: a.family, port: a.localPort}
+	ac := c.acceptors[key]
+	if ac == nil {
+		l, err := listen(context.Background(), a.family, a.localPort)
+		if err != nil {
+			return err
+		}
+		if err := helpers.SetListenBacklog(l, a.opts.Backlog); err != nil {
+			c.logf("failed to set listen backlog, err: %v", err)
+		}
+		ac = &acceptor{
+			key:      key,
+			l:        l,
+			attempts: map[string]*attempts{},
+			pending:  map[net.Conn]struct{}{},
+			done:     make(chan struct{}),
+		}
+		if c.acceptors == nil {
+			c.acceptors = map[acceptorKey]*acceptor{}
+		}
+		c.acceptors[key] = ac
+		go c.acceptLoop(ac)
+		c.logf("listening for incomming connections on port %v", a.localPort)
+	}
+	ac.attempts[string(a.sessionID)] = a
+	return nil
+}
+
+// leaveAcceptor unregisters the attempt, the last one to leave closes the listener and waits
+// for the connections still being routed, the listener is closed before another punch from the
+// port can open a new one so the kernel never hands connections to one that is closing
+func (c *Client) leaveAcceptor(a *attempts) {
+	c.acceptMut.Lock()
+	ac := c.acceptors[acceptorKey{family: a.family, port: a.localPort}]
+	delete(ac.attempts, string(a.sessionID))
+	if len(ac.attempts) > 0 {
+		c.acceptMut.Unlock()
+		return
+	}
+	ac.l.Close()
+	delete(c.acceptors, ac.key)
+	for con := range ac.pending {
+		con.SetDeadline(time.Unix(1, 0))
+	}
+	c.acceptMut.Unlock()
+
+	<-ac.done
+	ac.routing.Wait()
+}
+
+func (c *Client) acceptLoop(ac *acceptor) {
+	defer close(ac.done)
+	for {
+		con, err := ac.l.Accept()
+		if err != nil {
+			c.acceptMut.Lock()
+			closed := c.acceptors[ac.key] != ac
+			c.acceptMut.Unlock()
+			if !closed {
+				c.logf("failed to accept connection, err: %v", err)
+			}
+			return
+		}
+		c.logf("accepted connection from: %v", con.RemoteAddr())
+
+		c.acceptMut.Lock()
+		if c.acceptors[ac.key] != ac {
+			c.acceptMut.Unlock()
+			con.Close()
+			return
+		}
+		ac.pending[con] = struct{}{}
+		ac.routing.Add(1)
+		c.acceptMut.Unlock()
+		go c.route(ac, con)
+	}
+}
+
+// route reads the hello of an accepted connection and hands it to the tie break of the attempt
+// whose session it names, the peer sends its hello first so nothing is revealed to strangers
+func (c *Client) route(ac *acceptor, con net.Conn) {
+	con.SetReadDeadline(time.Now().Add(acceptHelloTimeout))
+	msg := make([]byte, len(helloMagic)+helpers.SessionIDSize)
+	_, err := io.ReadFull(con, msg)
+
+	c.acceptMut.Lock()
+	delete(ac.pending, con)
+	a, ok := ac.attempts[string(msg[len(helloMagic):])]
+	if err == nil && ok && string(msg[:len(helloMagic)]) == helloMagic {
+		// the attempt is still registered so its wait group cannot be waited on yet
+		a.wg.Add(1)
+	} else if err == nil {
+		err = errSessionMismatch
+	}
+	c.acceptMut.Unlock()
+	ac.routing.Done()
+
+	if err != nil {
+		c.logf("dropping connection with %v, err: %v", con.RemoteAddr(), err)
+		con.Close()
+		return
+	}
+	defer a.wg.Done()
+	con.SetReadDeadline(time.Time{})
+	c.tieBreak(a, con, true)
+}
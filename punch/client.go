@@ -0,0 +1,696 @@
+// Package punch establishes direct TCP connections between peers behind NATs,
+// using a negotiator server to exchange addresses and then punching through
+package punch
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+var (
+	ErrNotRegistered     = errors.New("client is not registered")
+	ErrAlreadyRegistered = errors.New("client is already registered")
+	ErrClientClosed      = errors.New("client is closed")
+	ErrObserver          = errors.New("observers cannot connect to peers")
+	ErrInvalidName       = errors.New("name is empty or too long")
+)
+
+// maxPendingOffers bounds the AllowPeer calls in progress at once
+const maxPendingOffers = 16
+
+// Client registers with a negotiator server and connects to other peers through it
+type Client struct {
+	// NegotiatorAddr is the ip:port of the negotiator server
+	NegotiatorAddr string
+	// Log receives progress messages, nothing is logged when it is nil
+	Log *log.Logger
+	// Token is a bearer token presented on registration, ignored when Secret is set
+	Token string
+	// Secret signs the registration with an HMAC when the negotiator requires one, the HMAC
+	// covers Identity so it cannot be swapped on the way to the negotiator
+	Secret []byte
+	// TLSConfig secures the connection to the negotiator when set, ServerName defaults to
+	// the host of NegotiatorAddr, the connection keeps the local port peers are punched from
+	TLSConfig *tls.Config
+	// SessionToken is presented on registration to take over a name held by an earlier
+	// session of this peer, Register replaces it with the token the negotiator issued
+	SessionToken string
+	// Identity is registered with the negotiator so peers can pin it, it is required by Secure
+	Identity ed25519.PrivateKey
+	// Secure runs TLS over every peer connection, each side only accepts the identity key
+	// the negotiator introduced the other side with, so the keys are only as trustworthy as the
+	// path to the negotiator, which TLSConfig or a Secret protects
+	Secure bool
+	// AllowInterfaces are path.Match patterns of the interfaces whose addresses are offered
+	// to peers as host candidates, every interface is offered when it is empty
+	AllowInterfaces []string
+	// DenyInterfaces are path.Match patterns of interfaces that are never offered
+	DenyInterfaces []string
+	// DiscoverNAT classifies the NAT in front of the client before registering, it needs
+	// a negotiator with alternate addresses to tell more than whether there is a NAT at all
+	DiscoverNAT bool
+	// PortPrediction samples how the NAT allocates ports when registering, and tries a window
+	// of predicted ports for peers whose NAT allocates them sequentially, following the mapping
+	// they sample when introduced
+	PortPrediction bool
+	// PredictionWindow is how many predicted ports of a peer are tried, defaults to 8
+	PredictionWindow int
+	// MaxPredictionSockets bounds the sockets opened for predicted ports of a peer, defaults to 32
+	MaxPredictionSockets int
+	// Relay falls back to a connection relayed by the negotiator when punching through fails
+	Relay bool
+	// RelayAfter is how long punching through is tried before falling back to the relay, defaults to 15 seconds
+	RelayAfter time.Duration
+	// Hidden leaves the client out of the peer lists of other peers, it can still be dialed by name
+	Hidden bool
+	// Observer only lists and watches peers, the negotiator authenticates the name without
+	// registering it so it may be in use by a peer, observers cannot dial or accept
+	Observer bool
+	// AllowPeer decides whether to accept a connection a peer requested, the negotiator only
+	// introduces the peer once it returns true, every connection is accepted when it is nil,
+	// it runs on its own goroutine and may block until the negotiator's offer timeout, offers
+	// arriving while 16 calls are in progress are declined
+	AllowPeer func(requester helpers.PeerEntry) bool
+	// DialOptions tune punching through for Dial and Accept
+	DialOptions DialOptions
+	// HeartbeatInterval is how often the idle negotiator connection is pinged, defaults to
+	// 15 seconds, heartbeats are off when it is negative
+	HeartbeatInterval time.Duration
+	// HeartbeatTimeout is how long the negotiator may stay silent before the connection
+	// is considered dead, defaults to three heartbeat intervals
+	HeartbeatTimeout time.Duration
+	// MaxReconnectDelay is the longest wait between tries to reconnect to the negotiator
+	// after the connection dropped, defaults to a minute
+	MaxReconnectDelay time.Duration
+
+	mut sync.Mutex
+	// subLock is held by the subscribe request in flight, subscriptions replace each other
+	subLock chan struct{}
+	// offerSlots holds a value for every AllowPeer call in progress
+	offerSlots chan struct{}
+	// acceptors are the listeners shared by the punches in progress by the port they punch from
+	acceptMut sync.Mutex
+	acceptors map[acceptorKey]*acceptor
+	name      string
+	con       net.Conn
+	fr        *helpers.Framer
+	localPort int
+	family    int
+	natType   peer.NATType
+	cert      *tls.Certificate
+	requestID uint32
+	// sessions holds the session id of the latest introduction of every peer
+	sessions map[string]string
+
+	// pending are the channels the replies to connection, list and subscribe requests
+	// are delivered on by request id
+	pending map[uint32]chan *peer.Response
+	// presence receives the events of subscribed peers
+	presence      chan PresenceEvent
+	subscriptions []string
+	intros        chan *introduction
+	// closing is closed by Close, done once the client gave up on the negotiator
+	closing chan struct{}
+	done    chan struct{}
+	err     error
+}
+
+func NewClient(negotiatorAddr string) *Client {
+	return &Client{NegotiatorAddr: negotiatorAddr}
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Log != nil {
+		c.Log.Printf(format, args...)
+	}
+}
+
+// Name returns the name the client registered with
+func (c *Client) Name() string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.name
+}
+
+// Register connects to the negotiator and registers the client under name,
+// other peers can then Dial it by that name
+func (c *Client) Register(ctx context.Context, name string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.con != nil {
+		return ErrAlreadyRegistered
+	}
+	if c.Identity == nil && c.Secure {
+		return ErrNoIdentity
+	}
+	if name == "" || len(name) > helpers.MaxNameLength {
+		return ErrInvalidName
+	}
+
+	r, err := c.register(ctx, name, c.SessionToken, 0, 0)
+	if err != nil {
+		return err
+	}
+	c.name = name
+	c.apply(r)
+	c.pending = map[uint32]chan *peer.Response{}
+	c.subLock = make(chan struct{}, 1)
+	c.offerSlots = make(chan struct{}, maxPendingOffers)
+	c.presence = make(chan PresenceEvent, presenceBuffer)
+	c.intros = make(chan *introduction, 16)
+	c.sessions = map[string]string{}
+	c.closing = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.readLoop(r.con, r.fr)
+
+	return nil
+}
+
+// registration is an accepted registration with the negotiator
+type registration struct {
+	con          net.Conn
+	fr           *helpers.Framer
+	localPort    int
+	family       int
+	natType      peer.NATType
+	sessionToken string
+}
+
+// apply makes r the client's connection to the negotiator, c.mut must be held
+func (c *Client) apply(r *registration) {
+	c.con = r.con
+	c.fr = r.fr
+	c.localPort = r.localPort
+	c.family = r.family
+	c.natType = r.natType
+	c.SessionToken = r.sessionToken
+}
+
+// register connects to the negotiator from localPort and registers name, a zero family
+// prefers a dual stack socket and a zero localPort lets the system pick one
+func (c *Client) register(ctx context.Context, name, sessionToken string, family, localPort int) (*registration, error) {
+	var identityKey []byte
+	if c.Identity != nil {
+		identityKey = c.Identity.Public().(ed25519.PublicKey)
+	}
+
+	con, localAddr, family, err := c.connectToNegotiatorServer(ctx, family, localPort)
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *helpers.Credential
+	switch {
+	case len(c.Secret) > 0:
+		if cred, err = helpers.NewHMACCredential(c.Secret, name, identityKey); err != nil {
+			con.Close()
+			return nil, fmt.Errorf("failed to sign registration, err: %v", err)
+		}
+	case c.Token != "":
+		cred = helpers.NewTokenCredential(c.Token)
+	}
+
+	fr := helpers.NewFramer(con)
+	natType := peer.NATTypeUnknown
+	if c.DiscoverNAT && !c.Observer {
+		natType = c.discoverNAT(ctx, con, fr, localAddr, family)
+		c.logf("discovered nat type: %v", natType)
+	}
+	var portDelta int32
+	if c.PortPrediction && !c.Observer && shouldPredict(natType) {
+		portDelta = c.samplePortDelta(ctx, con, family)
+		c.logf("sampled port delta: %v", portDelta)
+	}
+
+	if err := fr.WriteFrame(helpers.CreateRegistrationReq(&helpers.Registration{
+		Name:         name,
+		LocalAddr:    localAddr,
+		SessionToken: sessionToken,
+		Credential:   cred,
+		IdentityKey:  identityKey,
+		Candidates:   c.hostCandidates(localAddr, family),
+		NATType:      natType,
+		PortDelta:    portDelta,
+		Hidden:       c.Hidden,
+		Offers:       c.AllowPeer != nil,
+		Observer:     c.Observer,
+	})); err != nil {
+		con.Close()
+		return nil, fmt.Errorf("failed to register to negotiator, err: %v", err)
+	}
+	c.logf("registered as: %v, %v", name, helpers.SockaddrToStr(localAddr))
+
+	buf, err := fr.ReadFrame()
+	if err != nil {
+		con.Close()
+		return nil, fmt.Errorf("failed to read from negotiator server, err: %v", err)
+	}
+
+	resp, err := helpers.ParseResponse(buf)
+	if err != nil {
+		con.Close()
+		return nil, fmt.Errorf("malformed registration response, err: %v", err)
+	}
+	if err := helpers.ResponseErr(resp); err != nil {
+		con.Close()
+		return nil, err
+	}
+	ack, err := helpers.ResponseRegistrationAck(resp)
+	if err != nil {
+		con.Close()
+		return nil, fmt.Errorf("malformed registration response, err: %v", err)
+	}
+	me := ack.Peer(&peer.Peer{})
+	if me == nil {
+		con.Close()
+		return nil, fmt.Errorf("malformed registration response, err: registration ack has no peer")
+	}
+	c.logf("recognized as: %v, status=%v", helpers.PeerAddrToStr(me.RemoteAddr(&peer.Addr{})), ack.Status())
+
+	_, port := helpers.SockaddrIP(localAddr)
+	return &registration{
+		con:          con,
+		fr:           fr,
+		localPort:    port,
+		family:       family,
+		natType:      natType,
+		sessionToken: string(ack.SessionToken()),
+	}, nil
+}
+
+// local returns the family and port of the client's sockets, reconnecting may change them
+func (c *Client) local() (int, int) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.family, c.localPort
+}
+
+// NATType returns the NAT type discovered when registering, Unknown without DiscoverNAT
+func (c *Client) NATType() peer.NATType {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.natType
+}
+
+func (c *Client) connectToNegotiatorServer(ctx context.Context, family, localPort int) (net.Conn, syscall.Sockaddr, int, error) {
+	sAddr, err := helpers.StrToSockaddr(c.NegotiatorAddr)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to parse negotiator address, err: %v", err)
+	}
+
+	// a dual stack socket reaches peers of both families from the same port,
+	// hosts without IPv6 fall back to IPv4 only
+	fallback := family == 0
+	if fallback {
+		family = syscall.AF_INET6
+	}
+	con, laddr, err := c.dialNegotiator(ctx, family, localPort, c.NegotiatorAddr)
+	if err != nil && fallback && ctx.Err() == nil && helpers.SockaddrFamily(sAddr) == syscall.AF_INET {
+		family = syscall.AF_INET
+		con, laddr, err = c.dialNegotiator(ctx, family, localPort, c.NegotiatorAddr)
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	c.logf("connected to negotiator server using local address: %v", helpers.SockaddrToStr(laddr))
+	return con, laddr, family, nil
+}
+
+// dialNegotiator connects to a negotiator address from localPort and secures the connection
+// when TLS is configured, it returns the source address the connection leaves from
+func (c *Client) dialNegotiator(ctx context.Context, family, localPort int, addr string) (net.Conn, syscall.Sockaddr, error) {
+	con, err := dialer(family, localPort).DialContext(ctx, network(family), addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to negotiator server, err: %v", err)
+	}
+	local := con.LocalAddr().(*net.TCPAddr)
+	laddr := helpers.IPToSockaddr(local.IP, local.Port)
+
+	if c.TLSConfig != nil {
+		if con, err = c.secureNegotiatorConn(ctx, con); err != nil {
+			return nil, nil, err
+		}
+	}
+	return con, laddr, nil
+}
+
+// secureNegotiatorConn runs a TLS handshake over the already bound and connected socket,
+// so the local port stays the one the negotiator observes and peers are punched from
+func (c *Client) secureNegotiatorConn(ctx context.Context, con net.Conn) (net.Conn, error) {
+	cfg := c.TLSConfig.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.NegotiatorAddr)
+		if err != nil {
+			con.Close()
+			return nil, fmt.Errorf("failed to parse negotiator address, err: %v", err)
+		}
+		cfg.ServerName = host
+	}
+
+	tc := tls.Client(con, cfg)
+	if err := handshake(ctx, tc); err != nil {
+		tc.Close()
+		return nil, fmt.Errorf("tls handshake with negotiator failed, err: %v", err)
+	}
+	c.logf("secured negotiator connection: version=%x", tc.ConnectionState().Version)
+	return tc, nil
+}
+
+// readLoop serves the negotiator connection, when it drops the client reconnects
+// and registers again until it is closed
+func (c *Client) readLoop(con net.Conn, fr *helpers.Framer) {
+	for {
+		err := c.serve(con, fr)
+		con.Close()
+		select {
+		case <-c.closing:
+			c.err = ErrClientClosed
+			close(c.done)
+			return
+		default:
+		}
+
+		c.logf("lost connection to negotiator server, err: %v", err)
+		if con, fr, err = c.reconnect(); err != nil {
+			c.err = err
+			close(c.done)
+			return
+		}
+		c.resubscribe(fr)
+	}
+}
+
+// serve handles what the negotiator sends over con and pings it while idle, it returns
+// once reading fails or the negotiator stops answering
+func (c *Client) serve(con net.Conn, fr *helpers.Framer) error {
+	interval, timeout := c.heartbeat()
+	stop := make(chan struct{})
+	defer close(stop)
+	if interval > 0 {
+		go c.sendHeartbeats(fr, interval, stop)
+	}
+
+	for {
+		if timeout > 0 {
+			con.SetReadDeadline(time.Now().Add(timeout))
+		}
+		buf, err := fr.ReadFrame()
+		if err != nil {
+			return fmt.Errorf("failed to read from negotiator server, err: %v", err)
+		}
+
+		// a malformed frame must not take down the program embedding the client
+		resp, err := helpers.ParseResponse(buf)
+		if err != nil {
+			c.logf("dropping response from negotiator server, err: %v", err)
+			continue
+		}
+		switch resp.Type() {
+		case peer.ResponseTypeConnection:
+			// replies to requests of dials that gave up waiting may still arrive
+			if !c.deliver(resp) {
+				c.logf("dropping stale connection response: request=%v", resp.RequestId())
+			}
+		case peer.ResponseTypeListPeers:
+			if !c.deliver(resp) {
+				c.logf("dropping stale peer list: request=%v", resp.RequestId())
+			}
+		case peer.ResponseTypeSubscribe:
+			// renewals after a reconnect have nobody waiting for them
+			if !c.deliver(resp) {
+				if err := helpers.ResponseErr(resp); err != nil {
+					c.logf("subscription failed, err: %v", err)
+				}
+			}
+		case peer.ResponseTypePeerOnline, peer.ResponseTypePeerOffline:
+			c.handlePresence(resp)
+		case peer.ResponseTypeOffer:
+			c.answerOffer(fr, resp)
+		case peer.ResponseTypeIntroduction:
+			in, err := newIntroduction(resp)
+			if err != nil {
+				c.logf("malformed introduction, err: %v", err)
+				continue
+			}
+			pname := string(in.peer.Name())
+			c.mut.Lock()
+			c.sessions[pname] = string(in.sessionID)
+			c.mut.Unlock()
+			select {
+			case c.intros <- in:
+			default:
+				c.logf("dropping introduction from %v, too many pending", pname)
+			}
+		case peer.ResponseTypeSync:
+			nonce, sample, err := helpers.ResponseSync(resp)
+			if err != nil {
+				c.logf("malformed sync, err: %v", err)
+				continue
+			}
+			if sample {
+				// sampling connects to the negotiator, which must not hold up reading
+				go c.echoSample(con, fr, nonce)
+				continue
+			}
+			if err := fr.WriteFrame(helpers.CreateSyncRequest(nonce, 0)); err != nil {
+				c.logf("failed to echo sync, err: %v", err)
+			}
+		case peer.ResponseTypePong:
+			// answers a heartbeat, the read deadline was already extended
+		default:
+			c.logf("ignoring unexpected response: type=%v", resp.Type())
+		}
+	}
+}
+
+// answerOffer asks AllowPeer on its own goroutine whether to accept the offered connection and
+// tells the negotiator, offers beyond maxPendingOffers being decided at once are declined right away
+func (c *Client) answerOffer(fr *helpers.Framer, resp *peer.Response) {
+	requester, sessionID, err := helpers.ResponseOffer(resp)
+	if err != nil {
+		c.logf("malformed connection offer, err: %v", err)
+		return
+	}
+	select {
+	case c.offerSlots <- struct{}{}:
+	default:
+		c.logf("too many connection offers pending, declining: from=%v", requester.Name)
+		c.replyOffer(fr, sessionID, false)
+		return
+	}
+	go func() {
+		defer func() { <-c.offerSlots }()
+		accept := c.AllowPeer == nil || c.AllowPeer(requester)
+		c.logf("answering connection offer: from=%v accept=%v", requester.Name, accept)
+		c.replyOffer(fr, sessionID, accept)
+	}()
+}
+
+func (c *Client) replyOffer(fr *helpers.Framer, sessionID []byte, accept bool) {
+	if err := fr.WriteFrame(helpers.CreateOfferReply(sessionID, accept)); err != nil {
+		c.logf("failed to answer connection offer, err: %v", err)
+	}
+}
+
+// introduction is a peer the negotiator introduced and the moment to start connecting to it
+type introduction struct {
+	peer      *peer.Peer
+	sessionID []byte
+	start     time.Time
+	// scheduled is false when the negotiator left the start to the client
+	scheduled bool
+	// mappedPort is the peer's freshest mapping its predicted ports follow, 0 if unknown
+	mappedPort int
+}
+
+func newIntroduction(resp *peer.Response) (*introduction, error) {
+	in, err := helpers.ResponseIntroduction(resp)
+	if err != nil {
+		return nil, err
+	}
+	// the session id is read back from the hello of accepted connections by its size
+	if n := len(in.SessionIdBytes()); n != helpers.SessionIDSize {
+		return nil, fmt.Errorf("introduction has a %v byte session id", n)
+	}
+	return &introduction{
+		peer:       in.Peer(&peer.Peer{}),
+		sessionID:  append([]byte{}, in.SessionIdBytes()...),
+		start:      time.Now().Add(time.Duration(in.StartDelay()) * time.Millisecond),
+		scheduled:  in.StartDelay() > 0,
+		mappedPort: int(in.MappedPort()),
+	}, nil
+}
+
+// stale reports whether the introduction was superseded by a newer one of the same peer
+// or its start has passed so long ago the peer gave up on it
+func (c *Client) stale(in *introduction) bool {
+	c.mut.Lock()
+	latest := c.sessions[string(in.peer.Name())]
+	c.mut.Unlock()
+	return latest != string(in.sessionID) || time.Since(in.start) > introductionTTL
+}
+
+// await returns the channel the reply to the request with id is delivered on
+func (c *Client) await(id uint32) <-chan *peer.Response {
+	reply := make(chan *peer.Response, 1)
+	c.mut.Lock()
+	c.pending[id] = reply
+	c.mut.Unlock()
+	return reply
+}
+
+// forget stops waiting for the reply to the request with id
+func (c *Client) forget(id uint32) {
+	c.mut.Lock()
+	delete(c.pending, id)
+	c.mut.Unlock()
+}
+
+// deliver hands resp to the request it answers, it reports false if nobody waits for it
+func (c *Client) deliver(resp *peer.Response) bool {
+	c.mut.Lock()
+	reply, ok := c.pending[resp.RequestId()]
+	delete(c.pending, resp.RequestId())
+	c.mut.Unlock()
+	if ok {
+		reply <- resp
+	}
+	return ok
+}
+
+func (c *Client) registered() (*helpers.Framer, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.fr == nil {
+		return nil, ErrNotRegistered
+	}
+	return c.fr, nil
+}
+
+// Dial asks the negotiator to introduce the client to target and punches a connection to it,
+// the returned connection is a *Conn
+func (c *Client) Dial(ctx context.Context, target string) (net.Conn, error) {
+	return c.DialWithOptions(ctx, target, c.DialOptions)
+}
+
+// DialWithOptions is Dial with its own options instead of the client's DialOptions
+func (c *Client) DialWithOptions(ctx context.Context, target string, opts DialOptions) (net.Conn, error) {
+	fr, err := c.registered()
+	if err != nil {
+		return nil, err
+	}
+	if c.Observer {
+		return nil, ErrObserver
+	}
+
+	// dials run concurrently, each waits for the reply to its own request
+	id := atomic.AddUint32(&c.requestID, 1)
+	reply := c.await(id)
+	defer c.forget(id)
+	if err := fr.WriteFrame(helpers.CreateConnectionRequest(target, c.Name(), id)); err != nil {
+		return nil, fmt.Errorf("failed to send connection request, err: %v", err)
+	}
+
+	var resp *peer.Response
+	select {
+	case resp = <-reply:
+	case <-c.done:
+		return nil, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if err := helpers.ResponseErr(resp); err != nil {
+		return nil, err
+	}
+	in, err := newIntroduction(resp)
+	if err != nil {
+		return nil, fmt.Errorf("malformed connection response, err: %v", err)
+	}
+
+	opts = opts.withDefaults()
+	con, err := c.connectToPeer(ctx, in, opts)
+	if err != nil || !c.Secure {
+		return con, err
+	}
+	return c.secureSession(ctx, con, in.peer, true, opts)
+}
+
+// Accept waits for the negotiator to introduce another peer and punches a connection to it,
+// the returned connection is a *Conn
+func (c *Client) Accept(ctx context.Context) (net.Conn, error) {
+	return c.AcceptWithOptions(ctx, c.DialOptions)
+}
+
+// AcceptWithOptions is Accept with its own options instead of the client's DialOptions
+func (c *Client) AcceptWithOptions(ctx context.Context, opts DialOptions) (net.Conn, error) {
+	if _, err := c.registered(); err != nil {
+		return nil, err
+	}
+	if c.Observer {
+		return nil, ErrObserver
+	}
+
+	var in *introduction
+	for in == nil {
+		select {
+		case in = <-c.intros:
+		case <-c.done:
+			return nil, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.stale(in) {
+			c.logf("ignoring stale introduction from %v", string(in.peer.Name()))
+			in = nil
+		}
+	}
+	other := in.peer
+
+	c.logf("got connection request from: name=%v local=%v remote=%v nat=%v",
+		string(other.Name()),
+		helpers.PeerAddrToStr(other.LocalAddr(&peer.Addr{})),
+		helpers.PeerAddrToStr(other.RemoteAddr(&peer.Addr{})),
+		other.NatType())
+
+	opts = opts.withDefaults()
+	con, err := c.connectToPeer(ctx, in, opts)
+	if err != nil || !c.Secure {
+		return con, err
+	}
+	return c.secureSession(ctx, con, other, false, opts)
+}
+
+// Close closes the connection to the negotiator, established peer connections are not affected,
+// it returns the error the client gave up reconnecting to the negotiator with if it did
+func (c *Client) Close() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.con == nil {
+		return ErrNotRegistered
+	}
+	select {
+	case <-c.closing:
+		return ErrClientClosed
+	default:
+	}
+	close(c.closing)
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+	return c.con.Close()
+}
@@ -0,0 +1,115 @@
+package punch
+
+import (
+	"net"
+	"path"
+	"syscall"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// interfaceAllowed reports whether the interface name passes the client's allow and deny patterns
+func (c *Client) interfaceAllowed(name string) bool {
+	for _, pattern := range c.DenyInterfaces {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(c.AllowInterfaces) == 0 {
+		return true
+	}
+	for _, pattern := range c.AllowInterfaces {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// usableIP filters addresses other peers can never reach
+func usableIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// hostInterface is a network interface with the addresses assigned to it
+type hostInterface struct {
+	name  string
+	flags net.Flags
+	addrs []net.Addr
+}
+
+// interfaces lists the network interfaces of the host, the ones whose addresses cannot be listed are left out
+func (c *Client) interfaces() []hostInterface {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		c.logf("failed to list network interfaces, err: %v", err)
+	}
+	var hifs []hostInterface
+	for _, ifi := range ifs {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			c.logf("failed to list addresses of %v, err: %v", ifi.Name, err)
+			continue
+		}
+		hifs = append(hifs, hostInterface{name: ifi.Name, flags: ifi.Flags, addrs: addrs})
+	}
+	return hifs
+}
+
+// hostCandidates returns the addresses of every usable interface of family on the port the client punches from,
+// the address the negotiator connection leaves from is preferred since it routes to the internet
+func (c *Client) hostCandidates(localAddr syscall.Sockaddr, family int) []helpers.Candidate {
+	return c.interfaceCandidates(c.interfaces(), localAddr, family)
+}
+
+// interfaceCandidates returns the host candidates of the given interfaces, see hostCandidates
+func (c *Client) interfaceCandidates(ifs []hostInterface, localAddr syscall.Sockaddr, family int) []helpers.Candidate {
+	sourceIP, port := helpers.SockaddrIP(localAddr)
+
+	var cands []helpers.Candidate
+	for i, ifi := range ifs {
+		if ifi.flags&net.FlagUp == 0 || ifi.flags&net.FlagLoopback != 0 || !c.interfaceAllowed(ifi.name) {
+			continue
+		}
+		for _, addr := range ifi.addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || !usableIP(ipnet.IP) {
+				continue
+			}
+			if ipnet.IP.To4() == nil && family != syscall.AF_INET6 {
+				continue
+			}
+
+			// earlier interfaces and IPv4 addresses are preferred, the source address above all
+			pref := 0xfe00 - i*0x10
+			if ipnet.IP.To4() == nil {
+				pref -= 8
+			}
+			if ipnet.IP.Equal(sourceIP) {
+				pref = 0xffff
+			}
+			sa := helpers.IPToSockaddr(ipnet.IP, port)
+			cands = append(cands, helpers.Candidate{
+				Type:     peer.CandidateTypeHost,
+				Addr:     sa,
+				Priority: helpers.CandidatePriority(peer.CandidateTypeHost, pref),
+			})
+			c.logf("offering host candidate: interface=%v addr=%v", ifi.name, helpers.SockaddrToStr(sa))
+		}
+	}
+
+	// without usable interfaces the source address is the only address peers can try
+	if len(cands) == 0 {
+		cands = append(cands, helpers.Candidate{
+			Type:     peer.CandidateTypeHost,
+			Addr:     localAddr,
+			Priority: helpers.CandidatePriority(peer.CandidateTypeHost, 0xffff),
+		})
+	}
+	cands = helpers.SortCandidates(cands)
+	if len(cands) > helpers.MaxCandidates {
+		cands = cands[:helpers.MaxCandidates]
+	}
+	return cands
+}
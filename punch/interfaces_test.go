@@ -0,0 +1,137 @@
+package punch
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+)
+
+func TestInterfaceAllowed(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		allow, deny []string
+		allowed     []string
+		notAllowed  []string
+	}{
+		{
+			name:    "no patterns",
+			allowed: []string{"eth0", "wlan0", "docker0"},
+		},
+		{
+			name:       "allow list",
+			allow:      []string{"eth*", "wlan0"},
+			allowed:    []string{"eth0", "eth1", "wlan0"},
+			notAllowed: []string{"wlan1", "docker0"},
+		},
+		{
+			name:       "deny list",
+			deny:       []string{"docker*", "veth*"},
+			allowed:    []string{"eth0", "wlan0"},
+			notAllowed: []string{"docker0", "veth1234"},
+		},
+		{
+			name:       "deny takes precedence over allow",
+			allow:      []string{"eth*"},
+			deny:       []string{"eth1"},
+			allowed:    []string{"eth0", "eth2"},
+			notAllowed: []string{"eth1", "wlan0"},
+		},
+		{
+			name:       "malformed pattern matches nothing",
+			allow:      []string{"eth[", "wlan0"},
+			allowed:    []string{"wlan0"},
+			notAllowed: []string{"eth[", "eth0"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Client{AllowInterfaces: test.allow, DenyInterfaces: test.deny}
+			for _, name := range test.allowed {
+				if !c.interfaceAllowed(name) {
+					t.Errorf("expected %v to be allowed", name)
+				}
+			}
+			for _, name := range test.notAllowed {
+				if c.interfaceAllowed(name) {
+					t.Errorf("expected %v not to be allowed", name)
+				}
+			}
+		})
+	}
+}
+
+func ipNet(cidr string) net.Addr {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	ipnet.IP = ip
+	return ipnet
+}
+
+func TestInterfaceCandidates(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast
+	ifs := []hostInterface{
+		{name: "lo", flags: up | net.FlagLoopback, addrs: []net.Addr{ipNet("127.0.0.1/8"), ipNet("::1/128")}},
+		{name: "eth0", flags: up, addrs: []net.Addr{
+			ipNet("192.168.1.5/24"),
+			ipNet("fe80::1/64"),
+			ipNet("2001:db8::5/64"),
+			ipNet("169.254.10.1/16"),
+		}},
+		{name: "eth1", flags: net.FlagBroadcast, addrs: []net.Addr{ipNet("192.168.2.5/24")}},
+		{name: "docker0", flags: up, addrs: []net.Addr{ipNet("172.17.0.1/16")}},
+		{name: "wlan0", flags: up, addrs: []net.Addr{ipNet("10.0.0.7/24"), ipNet("127.0.0.2/8")}},
+	}
+	source := helpers.IPToSockaddr(net.ParseIP("10.0.0.7"), 4000)
+
+	for _, test := range []struct {
+		name   string
+		client *Client
+		family int
+		want   []string
+	}{
+		{
+			name:   "IPv4",
+			client: &Client{},
+			family: syscall.AF_INET,
+			want:   []string{"10.0.0.7:4000", "192.168.1.5:4000", "172.17.0.1:4000"},
+		},
+		{
+			name:   "IPv6",
+			client: &Client{},
+			family: syscall.AF_INET6,
+			want:   []string{"10.0.0.7:4000", "192.168.1.5:4000", "[2001:db8::5]:4000", "172.17.0.1:4000"},
+		},
+		{
+			name:   "denied interface",
+			client: &Client{DenyInterfaces: []string{"docker*"}},
+			family: syscall.AF_INET,
+			want:   []string{"10.0.0.7:4000", "192.168.1.5:4000"},
+		},
+		{
+			name:   "deny takes precedence over allow",
+			client: &Client{AllowInterfaces: []string{"eth*", "docker0"}, DenyInterfaces: []string{"docker0"}},
+			family: syscall.AF_INET,
+			want:   []string{"192.168.1.5:4000"},
+		},
+		{
+			name:   "loopback and down interfaces are never offered, the source address is then the only one",
+			client: &Client{AllowInterfaces: []string{"lo", "eth1"}},
+			family: syscall.AF_INET6,
+			want:   []string{"10.0.0.7:4000"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, cand := range test.client.interfaceCandidates(ifs, source, test.family) {
+				got = append(got, helpers.SockaddrToStr(cand.Addr))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Fatalf("expected %v, got: %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package punch
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// ListPeers returns up to limit of the peers registered under names starting with prefix,
+// sorted by name and starting after the name after, pass the returned next as after to get
+// the following page, next is empty on the last page, the negotiator picks the page size
+// when limit is 0 and leaves out hidden peers and peers the client may not connect to
+func (c *Client) ListPeers(ctx context.Context, prefix, after string, limit int) ([]helpers.PeerEntry, string, error) {
+	fr, err := c.registered()
+	if err != nil {
+		return nil, "", err
+	}
+
+	id := atomic.AddUint32(&c.requestID, 1)
+	reply := c.await(id)
+	defer c.forget(id)
+	if err := fr.WriteFrame(helpers.CreateListPeersRequest(prefix, after, uint32(limit), id)); err != nil {
+		return nil, "", fmt.Errorf("failed to send list peers request, err: %v", err)
+	}
+
+	var resp *peer.Response
+	select {
+	case resp = <-reply:
+	case <-c.done:
+		return nil, "", c.err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+
+	if err := helpers.ResponseErr(resp); err != nil {
+		return nil, "", err
+	}
+	entries, next, err := helpers.ResponsePeerList(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("malformed peer list, err: %v", err)
+	}
+	return entries, next, nil
+}
@@ -0,0 +1,256 @@
+package punch
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+const bindingTimeout = 2 * time.Second
+
+// maxCallbacks is how many binding callbacks the negotiator makes, from its primary ip and another
+const maxCallbacks = 2
+
+// bindingResult is what one binding request learned about the port being classified
+type bindingResult struct {
+	local  syscall.Sockaddr
+	mapped syscall.Sockaddr
+	others []syscall.Sockaddr
+}
+
+func sameAddr(a, b syscall.Sockaddr) bool {
+	return a != nil && b != nil && helpers.SockaddrToStr(a) == helpers.SockaddrToStr(b)
+}
+
+func sameIP(a, b syscall.Sockaddr) bool {
+	ipa, _ := helpers.SockaddrIP(a)
+	ipb, _ := helpers.SockaddrIP(b)
+	return ipa.Equal(ipb)
+}
+
+// binding sends a binding request over fr and reads its response
+func binding(fr *helpers.Framer, con net.Conn, callback bool) (*bindingResult, error) {
+	if err := fr.WriteFrame(helpers.CreateBindingRequest(callback)); err != nil {
+		return nil, err
+	}
+	con.SetReadDeadline(time.Now().Add(bindingTimeout))
+	defer con.SetReadDeadline(time.Time{})
+	buf, err := fr.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := helpers.ParseResponse(buf)
+	if err != nil {
+		return nil, err
+	}
+	if err := helpers.ResponseErr(resp); err != nil {
+		return nil, err
+	}
+	mapped, others, err := helpers.ResponseBinding(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &bindingResult{mapped: mapped, others: others}, nil
+}
+
+// bindingFrom sends a binding request to a negotiator address from a new socket bound to the client's port
+func (c *Client) bindingFrom(ctx context.Context, family, port int, addr syscall.Sockaddr) (*bindingResult, error) {
+	con, local, err := c.dialNegotiator(ctx, family, port, helpers.SockaddrToStr(addr))
+	if err != nil {
+		return nil, err
+	}
+	defer con.Close()
+	res, err := binding(helpers.NewFramer(con), con, false)
+	if err != nil {
+		return nil, err
+	}
+	res.local = local
+	return res, nil
+}
+
+// listenCallback listens on the client's port for the negotiator's binding callbacks,
+// the returned channel receives the ip of every one that arrives
+func (c *Client) listenCallback(ctx context.Context, family, port int) (chan net.IP, func(), error) {
+	l, err := listen(ctx, family, port)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen for the callback, err: %v", err)
+	}
+
+	arrived := make(chan net.IP, maxCallbacks)
+	go func() {
+		for {
+			con, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if addr, ok := con.RemoteAddr().(*net.TCPAddr); ok {
+				select {
+				case arrived <- addr.IP:
+				default:
+				}
+			}
+			con.Close()
+		}
+	}()
+	return arrived, func() { l.Close() }, nil
+}
+
+// natProbe is what discovery observed of the client's port, the bindings through the alternate
+// addresses are nil when the negotiator has none or they failed
+type natProbe struct {
+	local, primary syscall.Sockaddr
+	// first is the binding through the primary address, viaPort through an alternate on its ip
+	// and another port and viaIP through an alternate on another ip
+	first, viaPort, viaIP *bindingResult
+	// listened is set when the callbacks were waited for, otherwise filtering is unknown,
+	// fromPrimaryIP and fromOtherIP tell whether one arrived from the primary's ip or another
+	listened, fromPrimaryIP, fromOtherIP bool
+	// otherIPCallback is set when the negotiator has an ip to call back from besides the primary's
+	otherIPCallback bool
+}
+
+// classifyNAT classifies the NAT the way RFC 5780 does, mapping first and filtering second,
+// when the negotiator cannot call back from another ip a callback from its own only shows
+// the NAT does not filter by port
+func classifyNAT(p natProbe) peer.NATType {
+	if sameAddr(p.first.mapped, p.local) {
+		return peer.NATTypeOpen
+	}
+	if p.viaPort == nil && p.viaIP == nil {
+		return peer.NATTypeUnknown
+	}
+	if p.viaPort != nil && !sameAddr(p.viaPort.mapped, p.first.mapped) {
+		return peer.NATTypeSymmetric
+	}
+	if p.viaIP != nil && !sameAddr(p.viaIP.mapped, p.first.mapped) {
+		return peer.NATTypeAddressDependent
+	}
+
+	switch {
+	case !p.listened:
+		return peer.NATTypeCone
+	case p.fromOtherIP:
+		return peer.NATTypeFullCone
+	case p.fromPrimaryIP:
+		return peer.NATTypeRestrictedCone
+	default:
+		return peer.NATTypePortRestrictedCone
+	}
+}
+
+// discoverNAT classifies the NAT in front of the client's port, it compares the addresses the
+// negotiator observes the port from through its primary and alternate addresses and checks which
+// of the connections from ports the client never contacted get through
+func (c *Client) discoverNAT(ctx context.Context, con net.Conn, fr *helpers.Framer, localAddr syscall.Sockaddr, family int) peer.NATType {
+	_, port := helpers.SockaddrIP(localAddr)
+	primary, err := helpers.StrToSockaddr(con.RemoteAddr().String())
+	if err != nil {
+		c.logf("nat discovery failed, err: %v", err)
+		return peer.NATTypeUnknown
+	}
+	p := natProbe{local: localAddr, primary: primary}
+
+	arrived, stop, err := c.listenCallback(ctx, family, port)
+	if err != nil {
+		c.logf("cannot listen for the binding callback, filtering stays unknown, err: %v", err)
+	} else {
+		defer stop()
+	}
+
+	if p.first, err = binding(fr, con, arrived != nil); err != nil {
+		c.logf("nat discovery failed, err: %v", err)
+		return peer.NATTypeUnknown
+	}
+	c.logf("binding: local=%v mapped=%v", helpers.SockaddrToStr(localAddr), helpers.SockaddrToStr(p.first.mapped))
+	if sameAddr(p.first.mapped, localAddr) {
+		return peer.NATTypeOpen
+	}
+
+	// one alternate on another ip tells whether the mapping depends on the address,
+	// one on the same ip and another port whether it depends on the port
+	var altIP, altPort syscall.Sockaddr
+	for _, other := range p.first.others {
+		switch {
+		case sameAddr(other, primary):
+		case !sameIP(other, primary) && altIP == nil:
+			altIP = other
+		case sameIP(other, primary) && altPort == nil:
+			altPort = other
+		}
+	}
+	if altIP == nil && altPort == nil {
+		c.logf("negotiator has no alternate addresses, nat mapping stays unknown")
+		return peer.NATTypeUnknown
+	}
+	if altPort != nil {
+		p.viaPort = c.bindingVia(ctx, family, port, altPort)
+	}
+	if altIP != nil {
+		p.viaIP = c.bindingVia(ctx, family, port, altIP)
+	}
+
+	// the negotiator calls back from another ip when it has one of the client's family
+	p.otherIPCallback = altIP != nil && helpers.SockaddrFamily(altIP) == helpers.SockaddrFamily(primary)
+	if arrived != nil {
+		p.listened = true
+		c.awaitCallbacks(ctx, arrived, &p)
+	}
+	return classifyNAT(p)
+}
+
+// bindingVia sends a binding request to an alternate address, it returns nil if it failed
+func (c *Client) bindingVia(ctx context.Context, family, port int, alt syscall.Sockaddr) *bindingResult {
+	res, err := c.bindingFrom(ctx, family, port, alt)
+	if err != nil {
+		c.logf("binding to %v failed, err: %v", helpers.SockaddrToStr(alt), err)
+		return nil
+	}
+	c.logf("binding: via=%v mapped=%v", helpers.SockaddrToStr(alt), helpers.SockaddrToStr(res.mapped))
+	return res
+}
+
+// awaitCallbacks records which of the binding callbacks arrive within bindingTimeout
+func (c *Client) awaitCallbacks(ctx context.Context, arrived <-chan net.IP, p *natProbe) {
+	primaryIP, _ := helpers.SockaddrIP(p.primary)
+	timeout := time.After(bindingTimeout)
+	for !p.fromPrimaryIP || (p.otherIPCallback && !p.fromOtherIP) {
+		select {
+		case ip := <-arrived:
+			if ip.Equal(primaryIP) {
+				p.fromPrimaryIP = true
+			} else {
+				p.fromOtherIP = true
+			}
+		case <-timeout:
+			return
+		case <-ctx.Done():
+			p.listened = false
+			return
+		}
+	}
+}
+
+// punchability tells whether two peers behind the given NATs are likely to punch through
+// and why not, unknown NATs are assumed to be punchable
+func punchability(local, remote peer.NATType) (bool, string) {
+	varies := func(t peer.NATType) bool {
+		return t == peer.NATTypeSymmetric || t == peer.NATTypeAddressDependent
+	}
+	switch {
+	case local == peer.NATTypeOpen || remote == peer.NATTypeOpen:
+		return true, ""
+	case varies(local) && varies(remote):
+		return false, "both NATs map every destination to a new port"
+	case varies(local) && remote == peer.NATTypePortRestrictedCone,
+		varies(remote) && local == peer.NATTypePortRestrictedCone:
+		return false, "one NAT maps every destination to a new port and the other filters by port"
+	default:
+		return true, ""
+	}
+}
@@ -0,0 +1,82 @@
+package punch
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+func sockaddr(ip string, port int) syscall.Sockaddr {
+	return helpers.IPToSockaddr(net.ParseIP(ip), port)
+}
+
+func bound(ip string, port int) *bindingResult {
+	return &bindingResult{mapped: sockaddr(ip, port)}
+}
+
+func TestClassifyNAT(t *testing.T) {
+	local := sockaddr("192.168.1.2", 4000)
+	primary := sockaddr("203.0.113.1", 8080)
+	mapped := bound("198.51.100.7", 50000)
+	// cone is a probe of a NAT that keeps the mapping through both alternates
+	cone := func(listened, fromPrimaryIP, fromOtherIP bool) natProbe {
+		return natProbe{
+			local: local, primary: primary,
+			first: mapped, viaPort: mapped, viaIP: mapped,
+			listened: listened, fromPrimaryIP: fromPrimaryIP, fromOtherIP: fromOtherIP, otherIPCallback: true,
+		}
+	}
+
+	cases := []struct {
+		name  string
+		probe natProbe
+		want  peer.NATType
+	}{
+		{"not translated", natProbe{local: local, primary: primary, first: bound("192.168.1.2", 4000)}, peer.NATTypeOpen},
+		{"no alternates", natProbe{local: local, primary: primary, first: mapped}, peer.NATTypeUnknown},
+		{"new port per destination port",
+			natProbe{local: local, primary: primary, first: mapped, viaPort: bound("198.51.100.7", 50001), viaIP: bound("198.51.100.7", 50002)},
+			peer.NATTypeSymmetric},
+		{"new port per destination address",
+			natProbe{local: local, primary: primary, first: mapped, viaPort: mapped, viaIP: bound("198.51.100.7", 50001)},
+			peer.NATTypeAddressDependent},
+		{"only an alternate port", natProbe{local: local, primary: primary, first: mapped, viaPort: mapped}, peer.NATTypeCone},
+		{"only an alternate ip that maps anew",
+			natProbe{local: local, primary: primary, first: mapped, viaIP: bound("198.51.100.7", 50001)},
+			peer.NATTypeAddressDependent},
+		{"filtering unknown", cone(false, false, false), peer.NATTypeCone},
+		{"no filtering", cone(true, true, true), peer.NATTypeFullCone},
+		{"filters by address", cone(true, true, false), peer.NATTypeRestrictedCone},
+		{"filters by address and port", cone(true, false, false), peer.NATTypePortRestrictedCone},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := classifyNAT(tc.probe); got != tc.want {
+				t.Fatalf("expected %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPunchability(t *testing.T) {
+	cases := []struct {
+		local, remote peer.NATType
+		ok            bool
+	}{
+		{peer.NATTypeOpen, peer.NATTypeSymmetric, true},
+		{peer.NATTypeFullCone, peer.NATTypeSymmetric, true},
+		{peer.NATTypeRestrictedCone, peer.NATTypeAddressDependent, true},
+		{peer.NATTypeSymmetric, peer.NATTypeAddressDependent, false},
+		{peer.NATTypePortRestrictedCone, peer.NATTypeSymmetric, false},
+		{peer.NATTypeAddressDependent, peer.NATTypePortRestrictedCone, false},
+		{peer.NATTypeUnknown, peer.NATTypeSymmetric, true},
+	}
+	for _, tc := range cases {
+		if ok, _ := punchability(tc.local, tc.remote); ok != tc.ok {
+			t.Errorf("%v and %v: expected punchable=%v, got: %v", tc.local, tc.remote, tc.ok, ok)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package punch
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetries         = 3
+	defaultRetryDelay      = 2 * time.Second
+	defaultMaxRetryDelay   = 30 * time.Second
+	defaultAttemptTimeout  = 10 * time.Second
+	defaultDialTimeout     = 60 * time.Second
+	defaultBacklog         = 10
+	defaultStartDelay      = time.Second
+	defaultCandidatePacing = 200 * time.Millisecond
+)
+
+// DialOptions tune how the client punches through to a peer, zero fields take their defaults
+type DialOptions struct {
+	// Retries is how many sockets every candidate is tried with, defaults to 3
+	Retries int
+	// RetryDelay is the wait before the second try of a candidate, it doubles for every
+	// further try up to MaxRetryDelay, defaults to 2 seconds
+	RetryDelay time.Duration
+	// MaxRetryDelay caps the backoff between tries, defaults to 30 seconds
+	MaxRetryDelay time.Duration
+	// Jitter randomizes every retry delay by up to this fraction of it, 0.2 means ±20%,
+	// it is clamped to between 0 and 1
+	Jitter float64
+	// AttemptTimeout bounds a single connect try and the TLS handshake of secure clients,
+	// defaults to 10 seconds
+	AttemptTimeout time.Duration
+	// Timeout bounds punching through to the peer, the deadline of the context passed
+	// to Dial or Accept applies when it is earlier, defaults to 60 seconds
+	Timeout time.Duration
+	// Backlog is the listen backlog of the socket accepting the peer, defaults to 10
+	Backlog int
+	// StartDelay is how long to wait before connecting when the negotiator did not
+	// schedule the start, defaults to 1 second
+	StartDelay time.Duration
+	// CandidatePacing is how far apart candidates are started, defaults to 200 milliseconds
+	CandidatePacing time.Duration
+}
+
+func (o DialOptions) withDefaults() DialOptions {
+	if o.Retries <= 0 {
+		o.Retries = defaultRetries
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = defaultRetryDelay
+	}
+	if o.MaxRetryDelay <= 0 {
+		o.MaxRetryDelay = defaultMaxRetryDelay
+	}
+	if o.Jitter < 0 {
+		o.Jitter = 0
+	} else if o.Jitter > 1 {
+		o.Jitter = 1
+	}
+	if o.AttemptTimeout <= 0 {
+		o.AttemptTimeout = defaultAttemptTimeout
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultDialTimeout
+	}
+	if o.Backlog <= 0 {
+		o.Backlog = defaultBacklog
+	}
+	if o.StartDelay <= 0 {
+		o.StartDelay = defaultStartDelay
+	}
+	if o.CandidatePacing <= 0 {
+		o.CandidatePacing = defaultCandidatePacing
+	}
+	return o
+}
+
+// retryDelay returns the wait between the previous try of a candidate and try, counting from 0
+func (o DialOptions) retryDelay(try int) time.Duration {
+	d := o.RetryDelay
+	for i := 1; i < try && d < o.MaxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > o.MaxRetryDelay {
+		d = o.MaxRetryDelay
+	}
+	if o.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * o.Jitter * float64(d))
+	}
+	return d
+}
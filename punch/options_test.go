@@ -0,0 +1,49 @@
+package punch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	opts := DialOptions{RetryDelay: time.Second, MaxRetryDelay: 10 * time.Second}.withDefaults()
+	cases := []struct {
+		try  int
+		want time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := opts.retryDelay(tc.try); got != tc.want {
+			t.Errorf("try %v: expected %v, got: %v", tc.try, tc.want, got)
+		}
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	cases := []struct {
+		jitter   float64
+		min, max time.Duration
+	}{
+		{0, 4 * time.Second, 4 * time.Second},
+		{0.25, 3 * time.Second, 5 * time.Second},
+		{1, 0, 8 * time.Second},
+		// out of range jitter is clamped, so delays never go negative
+		{-1, 4 * time.Second, 4 * time.Second},
+		{3, 0, 8 * time.Second},
+	}
+	for _, tc := range cases {
+		opts := DialOptions{RetryDelay: time.Second, MaxRetryDelay: 4 * time.Second, Jitter: tc.jitter}.withDefaults()
+		for i := 0; i < 1000; i++ {
+			// the jitter applies to the capped delay
+			if got := opts.retryDelay(10); got < tc.min || got > tc.max {
+				t.Fatalf("jitter %v: expected a delay between %v and %v, got: %v", tc.jitter, tc.min, tc.max, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package punch
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+const (
+	portSamples              = 4
+	defaultPredictionWindow  = 8
+	defaultPredictionSockets = 32
+	// sampleTimeout bounds the connection a mapping sample takes
+	sampleTimeout = 2 * time.Second
+)
+
+// samplePortDelta opens a few connections to the negotiator from new ports and returns how far apart
+// the NAT allocated their mappings, it is 0 when the NAT preserves ports or allocates them unpredictably
+func (c *Client) samplePortDelta(ctx context.Context, con net.Conn, family int) int32 {
+	negotiator, err := helpers.StrToSockaddr(con.RemoteAddr().String())
+	if err != nil {
+		c.logf("port sampling failed, err: %v", err)
+		return 0
+	}
+
+	var locals, mapped []int
+	for i := 0; i < portSamples; i++ {
+		res, err := c.bindingFrom(ctx, family, 0, negotiator)
+		if err != nil {
+			c.logf("port sampling failed, err: %v", err)
+			return 0
+		}
+		_, local := helpers.SockaddrIP(res.local)
+		_, port := helpers.SockaddrIP(res.mapped)
+		locals = append(locals, local)
+		mapped = append(mapped, port)
+	}
+	c.logf("sampled mapped ports: %v", mapped)
+	delta, sequential := portDelta(locals, mapped)
+	if !sequential {
+		c.logf("mapped ports are not allocated sequentially, port prediction is off")
+	}
+	return int32(delta)
+}
+
+// portDelta returns how far apart the NAT mapped the sampled local ports, it is 0 when the NAT
+// preserves them and reports false when it allocates them unpredictably
+func portDelta(locals, mapped []int) (int, bool) {
+	preserved := true
+	for i := range mapped {
+		preserved = preserved && locals[i] == mapped[i]
+	}
+	if preserved || len(mapped) < 2 {
+		return 0, true
+	}
+
+	// the median step tolerates a mapping taken by another connection in between
+	deltas := make([]int, 0, len(mapped)-1)
+	for i := 1; i < len(mapped); i++ {
+		deltas = append(deltas, mapped[i]-mapped[i-1])
+	}
+	sort.Ints(deltas)
+	delta := deltas[len(deltas)/2]
+	for _, d := range deltas {
+		if d <= 0 || d > 2*delta {
+			return 0, false
+		}
+	}
+	return delta, true
+}
+
+// echoSample answers a sync that asks for a sample with the port the NAT mapped a new connection
+// to the negotiator to, 0 if sampling failed so the negotiator does not wait for nothing
+func (c *Client) echoSample(con net.Conn, fr *helpers.Framer, nonce uint64) {
+	var port int32
+	family, _ := c.local()
+	negotiator, err := helpers.StrToSockaddr(con.RemoteAddr().String())
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sampleTimeout)
+		var res *bindingResult
+		if res, err = c.bindingFrom(ctx, family, 0, negotiator); err == nil {
+			_, mapped := helpers.SockaddrIP(res.mapped)
+			port = int32(mapped)
+		}
+		cancel()
+	}
+	if err != nil {
+		c.logf("mapping sample failed, err: %v", err)
+	}
+	if err := fr.WriteFrame(helpers.CreateSyncRequest(nonce, port)); err != nil {
+		c.logf("failed to echo sync, err: %v", err)
+	}
+}
+
+// predictedCandidates guesses the ports the peer's NAT allocates next after the mapping it sampled
+// when it was introduced, they rank just below the observed mapping and at most the socket limit
+// are returned
+func (c *Client) predictedCandidates(p *peer.Peer, mappedPort int) []helpers.Candidate {
+	delta := int(p.PortDelta())
+	remote := p.RemoteAddr(&peer.Addr{})
+	if delta == 0 || remote == nil {
+		return nil
+	}
+	if mappedPort == 0 {
+		c.logf("no fresh mapping of %v to predict ports from", string(p.Name()))
+		return nil
+	}
+	base := helpers.PeerAddrToSockaddr(remote)
+	if base == nil {
+		return nil
+	}
+
+	window := c.PredictionWindow
+	if window <= 0 {
+		window = defaultPredictionWindow
+	}
+	limit := c.MaxPredictionSockets
+	if limit <= 0 {
+		limit = defaultPredictionSockets
+	}
+
+	ip, _ := helpers.SockaddrIP(base)
+	ports := predictPorts(mappedPort, delta, window, limit)
+	cands := make([]helpers.Candidate, 0, len(ports))
+	for k, port := range ports {
+		cands = append(cands, helpers.Candidate{
+			Type:     peer.CandidateTypeServerReflexive,
+			Addr:     helpers.IPToSockaddr(ip, port),
+			Priority: helpers.CandidatePriority(peer.CandidateTypeServerReflexive, 0) - int32(k+1),
+		})
+	}
+	c.logf("predicted %v ports of %v: delta=%v from=%v", len(cands), string(p.Name()), delta, mappedPort+delta)
+	return cands
+}
+
+// predictPorts returns the window of ports following mappedPort delta apart, at most limit of them,
+// ports past the top of the range are left out since NATs wrap around to wherever their range starts
+func predictPorts(mappedPort, delta, window, limit int) []int {
+	if delta <= 0 {
+		return nil
+	}
+	if window > limit {
+		window = limit
+	}
+	var ports []int
+	for k := 1; k <= window && mappedPort+k*delta <= 0xffff; k++ {
+		ports = append(ports, mappedPort+k*delta)
+	}
+	return ports
+}
+
+// shouldPredict reports whether sampling is worth it, NATs that map endpoint independently
+// keep the observed mapping for the peer and need no prediction
+func shouldPredict(natType peer.NATType) bool {
+	switch natType {
+	case peer.NATTypeOpen, peer.NATTypeCone, peer.NATTypeFullCone, peer.NATTypeRestrictedCone, peer.NATTypePortRestrictedCone:
+		return false
+	default:
+		return true
+	}
+}
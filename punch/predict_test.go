@@ -0,0 +1,58 @@
+package punch
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPortDelta(t *testing.T) {
+	cases := []struct {
+		name           string
+		locals, mapped []int
+		delta          int
+		sequential     bool
+	}{
+		{"preserved", []int{4000, 4001, 4002, 4003}, []int{4000, 4001, 4002, 4003}, 0, true},
+		{"sequential", []int{4000, 4001, 4002, 4003}, []int{50000, 50001, 50002, 50003}, 1, true},
+		{"sequential by two", []int{4000, 4001, 4002, 4003}, []int{50000, 50002, 50004, 50006}, 2, true},
+		// the median step tolerates one mapping taken by another connection in between
+		{"one taken in between", []int{4000, 4001, 4002, 4003}, []int{50000, 50001, 50003, 50004}, 1, true},
+		{"random", []int{4000, 4001, 4002, 4003}, []int{50000, 61234, 50017, 3012}, 0, false},
+		{"far apart", []int{4000, 4001, 4002, 4003}, []int{50000, 50001, 50002, 50100}, 0, false},
+		{"repeated", []int{4000, 4001, 4002, 4003}, []int{50000, 50000, 50001, 50002}, 0, false},
+		{"wrapped around while sampling", []int{4000, 4001, 4002, 4003}, []int{65534, 65535, 1024, 1025}, 0, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			delta, sequential := portDelta(tc.locals, tc.mapped)
+			if delta != tc.delta || sequential != tc.sequential {
+				t.Fatalf("expected delta=%v sequential=%v, got: delta=%v sequential=%v", tc.delta, tc.sequential, delta, sequential)
+			}
+		})
+	}
+}
+
+func TestPredictPorts(t *testing.T) {
+	cases := []struct {
+		name          string
+		mapped, delta int
+		window, limit int
+		want          string
+	}{
+		{"window", 50000, 1, 4, 32, "[50001 50002 50003 50004]"},
+		{"delta apart", 50000, 3, 3, 32, "[50003 50006 50009]"},
+		{"socket limit", 50000, 1, 8, 2, "[50001 50002]"},
+		{"top of the range", 65532, 1, 8, 32, "[65533 65534 65535]"},
+		{"top of the range by two", 65530, 2, 8, 32, "[65532 65534]"},
+		{"at the top", 65535, 1, 8, 32, "[]"},
+		{"no delta", 50000, 0, 8, 32, "[]"},
+		{"negative delta", 50000, -1, 8, 32, "[]"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := fmt.Sprint(predictPorts(tc.mapped, tc.delta, tc.window, tc.limit)); got != tc.want {
+				t.Fatalf("expected %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
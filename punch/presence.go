@@ -0,0 +1,99 @@
+package punch
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// presenceBuffer is how many presence events wait for the application before new ones are dropped
+const presenceBuffer = 64
+
+// PresenceEvent reports a subscribed peer coming online or going offline
+type PresenceEvent struct {
+	Peer   helpers.PeerEntry
+	Online bool
+}
+
+// Subscribe asks the negotiator to report when the named peers come online or go offline,
+// names may be path.Match patterns naming groups of peers such as team-*, they replace the
+// earlier subscription and no names unsubscribes, the peers already online are reported
+// right away and again after the client reconnected to the negotiator
+func (c *Client) Subscribe(ctx context.Context, names ...string) error {
+	fr, err := c.registered()
+	if err != nil {
+		return err
+	}
+
+	// subscriptions are sent one at a time so the one the negotiator applied last is the one kept
+	select {
+	case c.subLock <- struct{}{}:
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-c.subLock }()
+
+	id := atomic.AddUint32(&c.requestID, 1)
+	reply := c.await(id)
+	defer c.forget(id)
+	if err := fr.WriteFrame(helpers.CreateSubscribeRequest(names, id)); err != nil {
+		return fmt.Errorf("failed to send subscribe request, err: %v", err)
+	}
+
+	var resp *peer.Response
+	select {
+	case resp = <-reply:
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := helpers.ResponseErr(resp); err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	c.subscriptions = append([]string{}, names...)
+	c.mut.Unlock()
+	return nil
+}
+
+// Presence returns the channel presence events of subscribed peers are delivered on,
+// events are dropped while it is full, it is nil until the client registered
+func (c *Client) Presence() <-chan PresenceEvent {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.presence
+}
+
+// resubscribe renews the subscription over a new negotiator connection, the
+// acknowledgement is read by the read loop like any other
+func (c *Client) resubscribe(fr *helpers.Framer) {
+	c.mut.Lock()
+	names := c.subscriptions
+	c.mut.Unlock()
+	if len(names) == 0 {
+		return
+	}
+	if err := fr.WriteFrame(helpers.CreateSubscribeRequest(names, atomic.AddUint32(&c.requestID, 1))); err != nil {
+		c.logf("failed to renew subscription, err: %v", err)
+	}
+}
+
+func (c *Client) handlePresence(resp *peer.Response) {
+	e, err := helpers.ResponsePresence(resp)
+	if err != nil {
+		c.logf("malformed presence event, err: %v", err)
+		return
+	}
+	select {
+	case c.presence <- PresenceEvent{Peer: e, Online: resp.Type() == peer.ResponseTypePeerOnline}:
+	default:
+		c.logf("dropping presence event of %v, too many pending", e.Name)
+	}
+}
@@ -0,0 +1,304 @@
+package punch
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+const (
+	defaultRelayAfter = 15 * time.Second
+	introductionTTL   = 10 * time.Second
+)
+
+var (
+	errEstablishFailed = errors.New("failed to establish connection to peer")
+	errAttemptAborted  = errors.New("attempt aborted")
+)
+
+// Conn is a connection to a peer that was established through the negotiator
+type Conn struct {
+	net.Conn
+	peer        string
+	identityKey ed25519.PublicKey
+	path        Path
+}
+
+// PeerName returns the name the remote peer registered with
+func (c *Conn) PeerName() string {
+	return c.peer
+}
+
+// Path reports whether the connection was punched through or is relayed by the negotiator
+func (c *Conn) Path() Path {
+	return c.path
+}
+
+// Secure reports whether the connection is encrypted and the peer proved its identity key
+func (c *Conn) Secure() bool {
+	return c.identityKey != nil
+}
+
+// IdentityKey returns the identity key the peer proved, or nil if the connection is not secure
+func (c *Conn) IdentityKey() ed25519.PublicKey {
+	return c.identityKey
+}
+
+// unspecified returns the wildcard address sockets of family bind to
+func unspecified(family int) net.IP {
+	if family == syscall.AF_INET {
+		return net.IPv4zero
+	}
+	return net.IPv6unspecified
+}
+
+// network returns the network sockets of family are created for, IPv6 sockets
+// are dual stack and reach IPv4 peers through IPv4-mapped addresses
+func network(family int) string {
+	if family == syscall.AF_INET {
+		return "tcp4"
+	}
+	return "tcp"
+}
+
+// dialer returns a dialer whose sockets are bound to localPort and share it with the other sockets of the client
+func dialer(family, localPort int) *net.Dialer {
+	return &net.Dialer{
+		LocalAddr: &net.TCPAddr{IP: unspecified(family), Port: localPort},
+		Control:   helpers.ControlSocket,
+	}
+}
+
+// listen listens on localPort of every address, sharing the port with the other sockets of the client
+func listen(ctx context.Context, family, localPort int) (net.Listener, error) {
+	lc := &net.ListenConfig{Control: helpers.ControlSocket}
+	return lc.Listen(ctx, network(family), net.JoinHostPort(unspecified(family).String(), strconv.Itoa(localPort)))
+}
+
+func (c *Client) establishConnectionToPeer(ctx context.Context, in *introduction, opts DialOptions) (net.Conn, error) {
+	p := in.peer
+	pname := string(p.Name())
+	c.logf("trying to establish connection to: %v", pname)
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	var targets []target
+	for _, cand := range helpers.PeerCandidates(p) {
+		targets = append(targets, target{cand: cand, retries: opts.Retries})
+	}
+	// predicted ports are guesses, each gets a single socket
+	if c.PortPrediction {
+		for _, cand := range c.predictedCandidates(p, in.mappedPort) {
+			targets = append(targets, target{cand: cand, retries: 1})
+		}
+	}
+
+	localNAT, remoteNAT := c.NATType(), p.NatType()
+	if ok, why := punchability(localNAT, remoteNAT); !ok {
+		c.logf("%v is unlikely to punch through, local nat=%v remote nat=%v: %v", pname, localNAT, remoteNAT, why)
+	}
+
+	// reconnecting may move the client to another port, the punch keeps the one it started on
+	family, localPort := c.local()
+	a := newAttempts(ctx, opts, in.sessionID, c.Name() < pname, family, localPort)
+	defer a.stop()
+	a.wg.Add(1)
+	go c.attemptAccept(a)
+	// an open peer accepts right away, only NATs need the other side's hole opened first
+	if remoteNAT == peer.NATTypeOpen {
+		c.logf("punch strategy: connect directly, %v is not behind a nat", pname)
+	} else {
+		// the negotiator scheduled both sides to start together so the SYNs cross
+		wait := time.Until(in.start)
+		if !in.scheduled {
+			wait = opts.StartDelay
+		}
+		c.logf("punch strategy: simultaneous open in %v, local nat=%v remote nat=%v", wait.Round(time.Millisecond), localNAT, remoteNAT)
+		select {
+		case <-time.After(wait):
+		case con := <-a.conns:
+			return &Conn{Conn: con, peer: pname}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// candidates are started in priority order, a little apart so the preferred ones get a head start
+	next, started := 0, 0
+	startNext := func() {
+		for next < len(targets) {
+			next++
+			if c.startConnect(a, targets[next-1]) {
+				started++
+				return
+			}
+		}
+	}
+	startNext()
+	pacing := time.NewTicker(opts.CandidatePacing)
+	defer pacing.Stop()
+
+	failures := 0
+	for failures < started || next < len(targets) {
+		select {
+		case con := <-a.conns:
+			return &Conn{Conn: con, peer: pname}, nil
+		case <-a.failed:
+			failures++
+		case <-pacing.C:
+			startNext()
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				c.logf("timeout reached")
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	c.logf("all attempts to connect to: %v have failed", pname)
+	return nil, errEstablishFailed
+}
+
+// attempts are the concurrent tries of a single connection to a peer, the first
+// connection offered wins and every other one is closed
+type attempts struct {
+	opts DialOptions
+	// sessionID is the session of the introduction both peers check in the hello
+	sessionID []byte
+	// chooser is set for the peer with the smaller name, it picks the connection the pair uses
+	chooser bool
+	// family and localPort are those of the client's sockets when punching started
+	family    int
+	localPort int
+	// conns receives the winner
+	conns chan net.Conn
+	// failed receives a value for every target whose tries all failed
+	failed chan struct{}
+	// ctx is canceled once a connection won or punching gave up
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   <-chan struct{}
+	wg     sync.WaitGroup
+
+	mut    sync.Mutex
+	picked bool
+}
+
+func newAttempts(ctx context.Context, opts DialOptions, sessionID []byte, chooser bool, family, localPort int) *attempts {
+	ctx, cancel := context.WithCancel(ctx)
+	return &attempts{
+		opts:      opts,
+		sessionID: sessionID,
+		chooser:   chooser,
+		family:    family,
+		localPort: localPort,
+		conns:     make(chan net.Conn),
+		failed:    make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      ctx.Done(),
+	}
+}
+
+// offer hands con to the connection being established, it is closed if punching gave up meanwhile
+func (a *attempts) offer(con net.Conn) bool {
+	select {
+	case a.conns <- con:
+		return true
+	case <-a.done:
+		con.Close()
+		return false
+	}
+}
+
+func (a *attempts) fail() {
+	select {
+	case a.failed <- struct{}{}:
+	case <-a.done:
+	}
+}
+
+// stop aborts the tries still running and waits for all of them to return
+func (a *attempts) stop() {
+	a.cancel()
+	a.wg.Wait()
+}
+
+// target is a candidate to connect to and how many sockets to try it with
+type target struct {
+	cand    helpers.Candidate
+	retries int
+}
+
+// startConnect starts connecting to the target unless the client's sockets cannot reach its family
+func (c *Client) startConnect(a *attempts, t target) bool {
+	cand := t.cand
+	if _, ok := helpers.MapSockaddr(cand.Addr, a.family); !ok {
+		c.logf("skipping candidate %v, no IPv6 connectivity", helpers.SockaddrToStr(cand.Addr))
+		return false
+	}
+	c.logf("trying candidate: type=%v addr=%v priority=%v", cand.Type, helpers.SockaddrToStr(cand.Addr), cand.Priority)
+	a.wg.Add(1)
+	go c.attemptConnect(a, helpers.SockaddrToStr(cand.Addr), t.retries)
+	return true
+}
+
+// attemptConnect tries to connect to addr with up to retries sockets, a little apart,
+// the connections go through the tie break and it returns once all of its tries returned
+func (c *Client) attemptConnect(a *attempts, addr string, retries int) {
+	defer a.wg.Done()
+
+	// every try reports whether its connection was the one picked
+	results := make(chan bool, retries)
+	try := func(n int) {
+		c.logf("attempting to connect to %v retry=%v", addr, n)
+		ctx, cancel := context.WithTimeout(a.ctx, a.opts.AttemptTimeout)
+		defer cancel()
+		con, err := dialer(a.family, a.localPort).DialContext(ctx, network(a.family), addr)
+		if err != nil {
+			c.logf("failed to connect to %v, retry=%v, err=%v", addr, n, err)
+			results <- false
+			return
+		}
+		c.logf("succefully connected to %v", addr)
+		results <- c.tieBreak(a, con, false)
+	}
+
+	go try(0)
+	started, finished := 1, 0
+	var tagain <-chan time.Time
+	if retries > 1 {
+		tagain = time.After(a.opts.retryDelay(1))
+	}
+	done := a.done
+	won := false
+	for finished < started || tagain != nil {
+		select {
+		case ok := <-results:
+			finished++
+			if ok {
+				won, tagain = true, nil
+			}
+		case <-tagain:
+			go try(started)
+			started++
+			tagain = nil
+			if started < retries {
+				tagain = time.After(a.opts.retryDelay(started))
+			}
+		case <-done:
+			// the running tries abort, no new ones are started
+			done, tagain = nil, nil
+		}
+	}
+	if !won {
+		a.fail()
+	}
+}
@@ -0,0 +1,536 @@
+package punch
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/negotiator"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+	"github.com/arckey/tcp-punchthrough/types/request"
+	fb "github.com/google/flatbuffers/go"
+)
+
+// settleTimeout is how long goroutines and sockets get to wind down after a dial
+const settleTimeout = 5 * time.Second
+
+var testDialOptions = DialOptions{
+	Retries:        1,
+	AttemptTimeout: 2 * time.Second,
+	Timeout:        5 * time.Second,
+}
+
+// startNegotiator serves a negotiator on a loopback port for the duration of the test
+func startNegotiator(t *testing.T) string {
+	return startServer(t, negotiator.NewServer(nil))
+}
+
+func startServer(t *testing.T, srv *negotiator.Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, err: %v", err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return l.Addr().String()
+}
+
+func registerClient(t *testing.T, addr, name string) *Client {
+	c := NewClient(addr)
+	c.DialOptions = testDialOptions
+	if err := c.Register(context.Background(), name); err != nil {
+		t.Fatalf("failed to register %v, err: %v", name, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func countFDs(t *testing.T) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot count file descriptors, err: %v", err)
+	}
+	return len(fds)
+}
+
+// counts returns the goroutine and file descriptor counts once the goroutines the clients
+// start in the background, such as the heartbeats, are running
+func counts(t *testing.T) (int, int) {
+	time.Sleep(200 * time.Millisecond)
+	return runtime.NumGoroutine(), countFDs(t)
+}
+
+// assertSettled waits for the goroutine and file descriptor counts to drop back to the given ones
+func assertSettled(t *testing.T, goroutines, fds int) {
+	t.Helper()
+	deadline := time.Now().Add(settleTimeout)
+	for {
+		g, f := runtime.NumGoroutine(), countFDs(t)
+		if g <= goroutines && f <= fds {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Fatalf("leaked resources: goroutines %v -> %v, fds %v -> %v\n%s", goroutines, g, fds, f, buf)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// dialPair has b accept while a dials it and closes both ends
+func dialPair(t *testing.T, a, b *Client) {
+	t.Helper()
+	ctx := context.Background()
+	accepted := make(chan error, 1)
+	go func() {
+		con, err := b.Accept(ctx)
+		if err == nil {
+			con.Close()
+		}
+		accepted <- err
+	}()
+	con, err := a.Dial(ctx, b.Name())
+	if err != nil {
+		t.Fatalf("failed to dial %v, err: %v", b.Name(), err)
+	}
+	con.Close()
+	if err := <-accepted; err != nil {
+		t.Fatalf("failed to accept %v, err: %v", a.Name(), err)
+	}
+}
+
+func TestDialLeavesNoGoroutinesOrFDs(t *testing.T) {
+	addr := startNegotiator(t)
+	alice := registerClient(t, addr, "alice")
+	bob := registerClient(t, addr, "bob")
+
+	// the first dial starts the runtime's own long lived goroutines, such as the network poller's
+	dialPair(t, alice, bob)
+	goroutines, fds := counts(t)
+
+	for i := 0; i < 5; i++ {
+		dialPair(t, alice, bob)
+		dialPair(t, bob, alice)
+	}
+	assertSettled(t, goroutines, fds)
+}
+
+func TestFailedDialLeavesNoListener(t *testing.T) {
+	addr := startNegotiator(t)
+	alice := registerClient(t, addr, "alice")
+	bob := registerClient(t, addr, "bob")
+	goroutines, fds := counts(t)
+
+	// bob never accepts, so nothing listens on his port and every candidate is refused
+	_, err := alice.Dial(context.Background(), bob.Name())
+	if err != errEstablishFailed {
+		t.Fatalf("expected %v, got: %v", errEstablishFailed, err)
+	}
+
+	alice.acceptMut.Lock()
+	open := len(alice.acceptors)
+	alice.acceptMut.Unlock()
+	if open != 0 {
+		t.Fatalf("%v listeners of the failed dial are still open", open)
+	}
+	assertSettled(t, goroutines, fds)
+}
+
+// introducedPeer is the peer an introduction to name with the given identity key carries
+func introducedPeer(name string, key ed25519.PublicKey) *peer.Peer {
+	b := fb.NewBuilder(64)
+	n := b.CreateString(name)
+	k := b.CreateByteVector(key)
+	peer.PeerStart(b)
+	peer.PeerAddName(b, n)
+	peer.PeerAddIdentityKey(b, k)
+	b.Finish(peer.PeerEnd(b))
+	return peer.GetRootAsPeer(b.FinishedBytes(), 0)
+}
+
+func TestStalledHandshakeTimesOut(t *testing.T) {
+	_, identity, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate identity, err: %v", err)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate identity, err: %v", err)
+	}
+	c := NewClient("")
+	c.Identity = identity
+
+	// the peer won the tie break but never sends its client hello
+	local, remote := net.Pipe()
+	defer remote.Close()
+	opts := DialOptions{AttemptTimeout: 200 * time.Millisecond}.withDefaults()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.secureSession(context.Background(), &Conn{Conn: local, peer: "bob"}, introducedPeer("bob", other), false, opts)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected the stalled handshake to fail")
+		}
+	case <-time.After(settleTimeout):
+		t.Fatalf("stalled handshake did not time out")
+	}
+}
+
+func TestObserverSharesNameOfOnlinePeer(t *testing.T) {
+	addr := startNegotiator(t)
+	registerClient(t, addr, "alice")
+	registerClient(t, addr, "bob")
+
+	observer := NewClient(addr)
+	observer.Observer = true
+	if err := observer.Register(context.Background(), "alice"); err != nil {
+		t.Fatalf("failed to observe as alice, err: %v", err)
+	}
+	defer observer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+	entries, _, err := observer.ListPeers(ctx, "", "", 0)
+	if err != nil {
+		t.Fatalf("failed to list peers, err: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "alice" || entries[1].Name != "bob" {
+		t.Fatalf("expected alice and bob to be listed, got: %v", entries)
+	}
+
+	if err := observer.Subscribe(ctx, "alice"); err != nil {
+		t.Fatalf("failed to subscribe, err: %v", err)
+	}
+	select {
+	case ev := <-observer.Presence():
+		if ev.Peer.Name != "alice" || !ev.Online {
+			t.Fatalf("expected alice to be online, got: %+v", ev)
+		}
+	case <-ctx.Done():
+		t.Fatalf("no presence event of alice")
+	}
+
+	if _, err := observer.Dial(ctx, "bob"); err != ErrObserver {
+		t.Fatalf("expected %v, got: %v", ErrObserver, err)
+	}
+}
+
+func TestDialDoesNotWaitForOtherDials(t *testing.T) {
+	addr := startNegotiator(t)
+	alice := registerClient(t, addr, "alice")
+
+	// bob holds the offer of the first dial until the test is over
+	release := make(chan struct{})
+	bob := NewClient(addr)
+	bob.AllowPeer = func(helpers.PeerEntry) bool {
+		<-release
+		return false
+	}
+	if err := bob.Register(context.Background(), "bob"); err != nil {
+		t.Fatalf("failed to register bob, err: %v", err)
+	}
+	defer bob.Close()
+
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := alice.Dial(context.Background(), "bob")
+		blocked <- err
+	}()
+	defer func() {
+		close(release)
+		<-blocked
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+	_, err := alice.Dial(ctx, "nobody")
+	var re *helpers.ResponseError
+	if !errors.As(err, &re) || re.Code != peer.ErrorCodeNotFound {
+		t.Fatalf("expected a not found error, got: %v", err)
+	}
+}
+
+func TestPendingOffersAreBounded(t *testing.T) {
+	release := make(chan struct{})
+	var asked int32
+	c := NewClient("")
+	c.AllowPeer = func(helpers.PeerEntry) bool {
+		atomic.AddInt32(&asked, 1)
+		<-release
+		return true
+	}
+	c.offerSlots = make(chan struct{}, maxPendingOffers)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	fr, negotiatorFr := helpers.NewFramer(local), helpers.NewFramer(remote)
+	const offers = maxPendingOffers + 4
+	replies := make(chan bool, offers)
+	go func() {
+		for {
+			buf, err := negotiatorFr.ReadFrame()
+			if err != nil {
+				return
+			}
+			_, tab, err := helpers.ParseRequest(buf)
+			if err != nil {
+				t.Errorf("malformed offer reply, err: %v", err)
+				return
+			}
+			r := &request.OfferReply{}
+			r.Init(tab.Bytes, tab.Pos)
+			replies <- r.Accept()
+		}
+	}()
+
+	offer, err := helpers.ParseResponse(helpers.CreateOffer(helpers.PeerEntry{Name: "alice"}, []byte("session")))
+	if err != nil {
+		t.Fatalf("failed to parse offer, err: %v", err)
+	}
+	for i := 0; i < offers; i++ {
+		c.answerOffer(fr, offer)
+	}
+
+	// the offers beyond the bound are declined without asking
+	for i := maxPendingOffers; i < offers; i++ {
+		if accept := <-replies; accept {
+			t.Fatalf("expected offer %v to be declined", i)
+		}
+	}
+	close(release)
+	for i := 0; i < maxPendingOffers; i++ {
+		if accept := <-replies; !accept {
+			t.Fatalf("expected offer %v to be accepted", i)
+		}
+	}
+	if n := atomic.LoadInt32(&asked); n != maxPendingOffers {
+		t.Fatalf("expected AllowPeer to be asked %v times, got: %v", maxPendingOffers, n)
+	}
+}
+
+func TestReconnectGivesUpOnRefusedSessionToken(t *testing.T) {
+	srv := negotiator.NewServer(nil)
+	srv.DuplicatePolicy = negotiator.TokenDuplicate
+	addr := startServer(t, srv)
+	alice := registerClient(t, addr, "alice")
+
+	// another client takes the name over with alice's token, which the negotiator then replaces
+	thief := NewClient(addr)
+	thief.SessionToken = alice.sessionToken()
+	if err := thief.Register(context.Background(), "alice"); err != nil {
+		t.Fatalf("failed to take over alice, err: %v", err)
+	}
+	defer thief.Close()
+
+	select {
+	case <-alice.done:
+	case <-time.After(settleTimeout):
+		t.Fatalf("alice kept reconnecting")
+	}
+	var re *helpers.ResponseError
+	if err := alice.Close(); !errors.As(err, &re) || re.Code != peer.ErrorCodeInvalidSessionToken {
+		t.Fatalf("expected an invalid session token error, got: %v", err)
+	}
+}
+
+func TestSubscribeGivesUpWaitingForTheLock(t *testing.T) {
+	addr := startNegotiator(t)
+	alice := registerClient(t, addr, "alice")
+
+	// another subscription is in flight and never answered
+	alice.subLock <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := alice.Subscribe(ctx, "bob"); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+// blackholeProxy forwards connections to a negotiator until they are blackholed, from then on
+// their traffic is dropped without either end being closed, as a NAT that lost the mapping does
+type blackholeProxy struct {
+	target string
+
+	mut   sync.Mutex
+	pairs []*proxyPair
+}
+
+type proxyPair struct {
+	client, server net.Conn
+	dropped        int32
+}
+
+func startProxy(t *testing.T, target string) (*blackholeProxy, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, err: %v", err)
+	}
+	p := &blackholeProxy{target: target}
+	t.Cleanup(func() {
+		l.Close()
+		p.mut.Lock()
+		defer p.mut.Unlock()
+		for _, pair := range p.pairs {
+			pair.client.Close()
+			pair.server.Close()
+		}
+	})
+	go func() {
+		for {
+			con, err := l.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("tcp", target)
+			if err != nil {
+				con.Close()
+				continue
+			}
+			pair := &proxyPair{client: con, server: server}
+			p.mut.Lock()
+			p.pairs = append(p.pairs, pair)
+			p.mut.Unlock()
+			go pair.forward(con, server)
+			go pair.forward(server, con)
+		}
+	}()
+	return p, l.Addr().String()
+}
+
+// forward copies from src to dst until the pair is blackholed, a closed src is passed on to dst
+// only while the pair is not
+func (pair *proxyPair) forward(src, dst net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		if atomic.LoadInt32(&pair.dropped) == 1 {
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			dst.Close()
+			return
+		}
+		if _, err := dst.Write(buf[:n]); err != nil {
+			src.Close()
+			return
+		}
+	}
+}
+
+// blackhole drops the traffic of every connection forwarded so far
+func (p *blackholeProxy) blackhole() {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for _, pair := range p.pairs {
+		atomic.StoreInt32(&pair.dropped, 1)
+	}
+}
+
+func TestReconnectWaitsForTheDroppedSessionToExpire(t *testing.T) {
+	srv := negotiator.NewServer(nil)
+	srv.HeartbeatTimeout = 2 * time.Second
+	proxy, addr := startProxy(t, startServer(t, srv))
+
+	alice := NewClient(addr)
+	alice.HeartbeatInterval = 100 * time.Millisecond
+	alice.MaxReconnectDelay = 200 * time.Millisecond
+	if err := alice.Register(context.Background(), "alice"); err != nil {
+		t.Fatalf("failed to register alice, err: %v", err)
+	}
+	defer alice.Close()
+
+	// the negotiator holds alice's name until its heartbeat timeout, well after alice noticed the drop
+	proxy.blackhole()
+	deadline := time.Now().Add(4 * srv.HeartbeatTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-alice.done:
+			t.Fatalf("alice gave up reconnecting, err: %v", alice.Close())
+		default:
+		}
+		// listing over the blackholed connection goes unanswered, so alice is back once it is answered
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		_, _, err := alice.ListPeers(ctx, "", "", 0)
+		cancel()
+		if err == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("alice did not get her name back")
+}
+
+// freePort returns a loopback port nothing listens on
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, err: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestAcceptorsAreKeyedByPort(t *testing.T) {
+	c := NewClient("")
+	opts := DialOptions{}.withDefaults()
+	// a reconnect moved the client from the first port to the second while a punch was in progress
+	first, second := freePort(t), freePort(t)
+	attempt := func(id byte, port int) *attempts {
+		a := newAttempts(context.Background(), opts, bytes.Repeat([]byte{id}, helpers.SessionIDSize), false, syscall.AF_INET, port)
+		if err := c.joinAcceptor(a); err != nil {
+			t.Fatalf("failed to join acceptor, err: %v", err)
+		}
+		return a
+	}
+	a1, a2, a3 := attempt(1, first), attempt(2, second), attempt(3, first)
+
+	c.acceptMut.Lock()
+	listening := len(c.acceptors)
+	c.acceptMut.Unlock()
+	if listening != 2 {
+		t.Fatalf("expected a listener on each port, got: %v", listening)
+	}
+
+	c.leaveAcceptor(a1)
+	c.leaveAcceptor(a2)
+	if con, err := net.Dial("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(first))); err != nil {
+		t.Fatalf("expected the listener of the punch still in progress to stay open, err: %v", err)
+	} else {
+		con.Close()
+	}
+	if _, err := net.Dial("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(second))); err == nil {
+		t.Fatalf("expected the listener of the finished punch to be closed")
+	}
+
+	// the last punch to leave has closed the listener by the time it returns
+	c.leaveAcceptor(a3)
+	if _, err := net.Dial("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(first))); err == nil {
+		t.Fatalf("expected the listener to be closed")
+	}
+}
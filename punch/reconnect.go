@@ -0,0 +1,130 @@
+package punch
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+const (
+	defaultHeartbeatInterval = 15 * time.Second
+	defaultMaxReconnectDelay = time.Minute
+	reconnectDelay           = time.Second
+)
+
+// heartbeat returns the ping interval and read timeout of the negotiator connection, zero disables either
+func (c *Client) heartbeat() (time.Duration, time.Duration) {
+	interval := c.HeartbeatInterval
+	if interval == 0 {
+		interval = defaultHeartbeatInterval
+	}
+	if interval < 0 {
+		return 0, c.HeartbeatTimeout
+	}
+	timeout := c.HeartbeatTimeout
+	if timeout == 0 {
+		timeout = 3 * interval
+	}
+	return interval, timeout
+}
+
+// sendHeartbeats pings the negotiator every interval until stop is closed, a failed write
+// ends it as reading fails as well
+func (c *Client) sendHeartbeats(fr *helpers.Framer, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := fr.WriteFrame(helpers.CreatePing(time.Now())); err != nil {
+				c.logf("failed to send heartbeat, err: %v", err)
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// retryable reports whether a registration the negotiator refused may succeed when tried again,
+// credentials and session tokens stay refused while a taken name is retried, the dropped connection
+// holds it until the negotiator times it out and only the negotiator knows when that is
+func retryable(err error) bool {
+	var re *helpers.ResponseError
+	if !errors.As(err, &re) {
+		return true
+	}
+	switch re.Code {
+	case peer.ErrorCodeUnauthorized, peer.ErrorCodeForbidden, peer.ErrorCodeBadRequest,
+		peer.ErrorCodeInvalidSessionToken, peer.ErrorCodeOwnerAlive:
+		return false
+	default:
+		return true
+	}
+}
+
+// reconnect registers the client's name again from the same port, backing off between tries,
+// the session token lets it take the name back before the negotiator notices the old connection died,
+// it gives up once the negotiator refuses the registration for good
+func (c *Client) reconnect() (net.Conn, *helpers.Framer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	maxDelay := c.MaxReconnectDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxReconnectDelay
+	}
+	delay := reconnectDelay
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	for try := 1; ; try++ {
+		c.mut.Lock()
+		name, token, family, localPort := c.name, c.SessionToken, c.family, c.localPort
+		c.mut.Unlock()
+
+		r, err := c.register(ctx, name, token, family, localPort)
+		if err == nil {
+			c.mut.Lock()
+			defer c.mut.Unlock()
+			select {
+			case <-c.closing:
+				r.con.Close()
+				return nil, nil, ErrClientClosed
+			default:
+			}
+			c.apply(r)
+			c.logf("reconnected to negotiator server after %v tries", try)
+			return r.con, r.fr, nil
+		}
+
+		if !retryable(err) {
+			c.logf("giving up reconnecting to negotiator server after %v tries, err: %v", try, err)
+			return nil, nil, err
+		}
+
+		// waits are spread over half to one and a half the delay so peers dropped together do not return together
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		c.logf("failed to reconnect to negotiator server, retrying in %v, err: %v", wait.Round(time.Millisecond), err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, nil, ErrClientClosed
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
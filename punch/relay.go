@@ -0,0 +1,113 @@
+package punch
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+// Path is the way a connection to a peer reaches it
+type Path int
+
+const (
+	// PathDirect is a connection punched straight through to the peer
+	PathDirect Path = iota
+	// PathRelay is a connection the negotiator relays to the peer
+	PathRelay
+)
+
+func (p Path) String() string {
+	switch p {
+	case PathDirect:
+		return "direct"
+	case PathRelay:
+		return "relay"
+	default:
+		return fmt.Sprintf("Path(%d)", int(p))
+	}
+}
+
+func (c *Client) sessionToken() string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.SessionToken
+}
+
+// relay asks the negotiator to relay a new connection to the peer, the peer must ask for the same
+func (c *Client) relay(ctx context.Context, p *peer.Peer) (net.Conn, error) {
+	pname := string(p.Name())
+	family, _ := c.local()
+	con, _, err := c.dialNegotiator(ctx, family, 0, c.NegotiatorAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	fr := helpers.NewFramer(con)
+	if err := fr.WriteFrame(helpers.CreateRelayRequest(c.Name(), c.sessionToken(), pname)); err != nil {
+		con.Close()
+		return nil, fmt.Errorf("failed to send relay request, err: %v", err)
+	}
+	c.logf("waiting for the negotiator to relay to: %v", pname)
+
+	type reply struct {
+		buf []byte
+		err error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		buf, err := fr.ReadFrame()
+		replies <- reply{buf, err}
+	}()
+
+	var r reply
+	select {
+	case r = <-replies:
+	case <-ctx.Done():
+		con.Close()
+		return nil, ctx.Err()
+	}
+	if r.err != nil {
+		con.Close()
+		return nil, fmt.Errorf("failed to read relay response, err: %v", r.err)
+	}
+	resp, err := helpers.ParseResponse(r.buf)
+	if err != nil {
+		con.Close()
+		return nil, fmt.Errorf("malformed relay response, err: %v", err)
+	}
+	if err := helpers.ResponseErr(resp); err != nil {
+		con.Close()
+		return nil, err
+	}
+	if resp.Type() != peer.ResponseTypeRelay {
+		con.Close()
+		return nil, fmt.Errorf("unexpected relay response: type=%v", resp.Type())
+	}
+
+	c.logf("relaying connection to: %v", pname)
+	return &Conn{Conn: con, peer: pname, path: PathRelay}, nil
+}
+
+// connectToPeer punches a connection to the peer and falls back to the relay if that fails
+func (c *Client) connectToPeer(ctx context.Context, in *introduction, opts DialOptions) (net.Conn, error) {
+	p := in.peer
+	if !c.Relay {
+		return c.establishConnectionToPeer(ctx, in, opts)
+	}
+
+	after := c.RelayAfter
+	if after == 0 {
+		after = defaultRelayAfter
+	}
+	punchCtx, cancel := context.WithTimeout(ctx, after)
+	defer cancel()
+	con, err := c.establishConnectionToPeer(punchCtx, in, opts)
+	if err == nil || ctx.Err() != nil {
+		return con, err
+	}
+	c.logf("punching through to %v failed, falling back to the relay, err: %v", string(p.Name()), err)
+	return c.relay(ctx, p)
+}
@@ -0,0 +1,185 @@
+package punch
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/types/peer"
+)
+
+var (
+	ErrNoIdentity     = errors.New("secure sessions require an identity key")
+	ErrPeerNoIdentity = errors.New("peer did not register an identity key")
+	ErrIdentityDenied = errors.New("peer presented a different identity key than the negotiator introduced")
+)
+
+// LoadOrCreateIdentity reads a PEM encoded ed25519 private key from filename,
+// generating and saving a new one if the file does not exist
+func LoadOrCreateIdentity(filename string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+			return nil, err
+		}
+		return priv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no private key found in %v", filename)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%v does not hold an ed25519 key", filename)
+	}
+	return priv, nil
+}
+
+// Fingerprint returns a short printable digest of an identity key
+func Fingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:16])
+}
+
+// identityCert returns a self signed certificate for the identity key, peers never check
+// the certificate itself, only that its key is the one the negotiator introduced
+func (c *Client) identityCert() (tls.Certificate, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.cert != nil {
+		return *c.cert, nil
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: c.name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, c.Identity.Public(), c.Identity)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	c.cert = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: c.Identity}
+	return *c.cert, nil
+}
+
+func verifyPinnedKey(expected ed25519.PublicKey) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrIdentityDenied
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		key, ok := cert.PublicKey.(ed25519.PublicKey)
+		if !ok || !bytes.Equal(key, expected) {
+			return ErrIdentityDenied
+		}
+		return nil
+	}
+}
+
+// handshake runs the TLS handshake of tc, giving up when ctx is done
+func handshake(ctx context.Context, tc *tls.Conn) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		tc.SetDeadline(deadline)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- tc.Handshake()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		return tc.SetDeadline(time.Time{})
+	case <-ctx.Done():
+		tc.Close()
+		return ctx.Err()
+	}
+}
+
+// secureSession runs TLS over a punched connection, both sides present their identity key
+// and only accept the key the negotiator introduced the other side with,
+// the peer that dialed acts as the TLS client, the handshake is bounded by the attempt timeout
+// so a peer that stalls it cannot hold up Dial or Accept
+func (c *Client) secureSession(ctx context.Context, con net.Conn, p *peer.Peer, dialer bool, opts DialOptions) (net.Conn, error) {
+	pname := string(p.Name())
+	expected := ed25519.PublicKey(append([]byte{}, p.IdentityKeyBytes()...))
+	if len(expected) != ed25519.PublicKeySize {
+		con.Close()
+		return nil, ErrPeerNoIdentity
+	}
+
+	cert, err := c.identityCert()
+	if err != nil {
+		con.Close()
+		return nil, fmt.Errorf("failed to create identity certificate, err: %v", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates:          []tls.Certificate{cert},
+		MinVersion:            tls.VersionTLS13,
+		InsecureSkipVerify:    true, // the certificate chain is replaced by the pinned key check
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: verifyPinnedKey(expected),
+	}
+
+	inner := con.(*Conn)
+	var tc *tls.Conn
+	if dialer {
+		tc = tls.Client(inner.Conn, cfg)
+	} else {
+		tc = tls.Server(inner.Conn, cfg)
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.AttemptTimeout)
+	defer cancel()
+	if err := handshake(ctx, tc); err != nil {
+		tc.Close()
+		return nil, fmt.Errorf("secure session with %v failed, err: %v", pname, err)
+	}
+	c.logf("secured session with %v, identity=%v", pname, Fingerprint(expected))
+
+	return &Conn{Conn: tc, peer: pname, identityKey: expected, path: inner.path}, nil
+}
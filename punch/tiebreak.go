@@ -0,0 +1,124 @@
+package punch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// helloMagic starts the handshake every punched connection runs before it is used
+const helloMagic = "PNCH"
+
+var errSessionMismatch = errors.New("connection belongs to another session")
+
+const (
+	verdictDrop byte = iota
+	verdictPick
+)
+
+// hello exchanges the session id of the introduction, so connections of another
+// session or from strangers that happen to hit the port are never used, greeted
+// connections already sent theirs and only get the reply
+func hello(con net.Conn, sessionID []byte, greeted bool) error {
+	msg := append([]byte(helloMagic), sessionID...)
+	if _, err := con.Write(msg); err != nil || greeted {
+		return err
+	}
+	other := make([]byte, len(msg))
+	if _, err := io.ReadFull(con, other); err != nil {
+		return err
+	}
+	if !bytes.Equal(other, msg) {
+		return errSessionMismatch
+	}
+	return nil
+}
+
+// tieBreak agrees with the peer on whether con is the connection the pair uses and offers it if so,
+// simultaneous open can establish several connections, the peer with the smaller name picks the
+// first one through the hello and tells the other peer which one it picked, every other one is closed,
+// accepted connections were routed by the hello they sent and are greeted
+func (c *Client) tieBreak(a *attempts, con net.Conn, greeted bool) bool {
+	raddr := con.RemoteAddr()
+	// the handshake gives up when the attempt times out or another connection won
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-a.done:
+			con.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	con.SetDeadline(time.Now().Add(a.opts.AttemptTimeout))
+
+	err := hello(con, a.sessionID, greeted)
+	if err == nil {
+		err = a.verdict(con)
+	}
+	close(stop)
+	<-stopped
+	if err != nil {
+		c.logf("dropping connection with %v, err: %v", raddr, err)
+		con.Close()
+		return false
+	}
+	con.SetDeadline(time.Time{})
+	c.logf("tie break picked connection with %v", raddr)
+	return a.offer(con)
+}
+
+// verdict picks con if no other connection was picked yet when the client is the chooser,
+// otherwise it waits for the chooser to tell whether it picked con, a pick is acknowledged so
+// the chooser never keeps a connection the peer already gave up on
+func (a *attempts) verdict(con net.Conn) error {
+	v := []byte{verdictDrop}
+	if !a.chooser {
+		if _, err := io.ReadFull(con, v); err != nil {
+			return err
+		}
+		if v[0] != verdictPick {
+			return fmt.Errorf("peer picked another connection")
+		}
+		_, err := con.Write(v)
+		return err
+	}
+
+	if !a.claim() {
+		con.Write(v)
+		return fmt.Errorf("picked another connection")
+	}
+	v[0] = verdictPick
+	if _, err := con.Write(v); err != nil {
+		a.release()
+		return err
+	}
+	if _, err := io.ReadFull(con, v); err != nil {
+		a.release()
+		return fmt.Errorf("peer did not take the picked connection, err: %v", err)
+	}
+	if v[0] != verdictPick {
+		a.release()
+		return fmt.Errorf("peer did not take the picked connection")
+	}
+	return nil
+}
+
+func (a *attempts) claim() bool {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if a.picked {
+		return false
+	}
+	a.picked = true
+	return true
+}
+
+func (a *attempts) release() {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	a.picked = false
+}
@@ -0,0 +1,137 @@
+package punch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/arckey/tcp-punchthrough/helpers"
+)
+
+var testSessionID = bytes.Repeat([]byte{1}, helpers.SessionIDSize)
+
+func testAttempts(t *testing.T, chooser bool) *attempts {
+	opts := DialOptions{AttemptTimeout: time.Second}.withDefaults()
+	a := newAttempts(context.Background(), opts, testSessionID, chooser, syscall.AF_INET, 0)
+	t.Cleanup(a.cancel)
+	return a
+}
+
+// greet reads the hello the other end of con sends first, as routing an accepted connection does
+func greet(con net.Conn) error {
+	_, err := io.ReadFull(con, make([]byte, len(helloMagic)+helpers.SessionIDSize))
+	return err
+}
+
+// won returns the connection offered to a, if any is within a short wait
+func won(a *attempts) net.Conn {
+	select {
+	case con := <-a.conns:
+		return con
+	case <-time.After(200 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestTieBreakKeepsOneConnection(t *testing.T) {
+	c := NewClient("")
+	chooser, other := testAttempts(t, true), testAttempts(t, false)
+
+	// simultaneous open established two connections between the peers
+	type pair struct{ chooser, other net.Conn }
+	var pairs []pair
+	for i := 0; i < 2; i++ {
+		a, b := net.Pipe()
+		defer a.Close()
+		defer b.Close()
+		pairs = append(pairs, pair{a, b})
+	}
+	var wg sync.WaitGroup
+	for _, p := range pairs {
+		p := p
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.tieBreak(chooser, p.chooser, false)
+		}()
+		go func() {
+			defer wg.Done()
+			if greet(p.other) == nil {
+				c.tieBreak(other, p.other, true)
+			}
+		}()
+	}
+
+	picked, taken := won(chooser), won(other)
+	if picked == nil || taken == nil {
+		t.Fatalf("expected both peers to keep a connection, chooser=%v other=%v", picked != nil, taken != nil)
+	}
+	if extra := won(chooser); extra != nil {
+		t.Fatalf("chooser kept a second connection")
+	}
+	if extra := won(other); extra != nil {
+		t.Fatalf("peer kept a second connection")
+	}
+	chooser.cancel()
+	other.cancel()
+	wg.Wait()
+
+	// both kept the two ends of the same connection, the other one is closed on both ends
+	for _, p := range pairs {
+		kept := p.chooser == picked
+		if kept != (p.other == taken) {
+			t.Fatalf("the peers kept different connections")
+		}
+		if kept {
+			continue
+		}
+		for _, con := range []net.Conn{p.chooser, p.other} {
+			if _, err := con.Write([]byte{0}); err != io.ErrClosedPipe {
+				t.Fatalf("expected the dropped connection to be closed, got: %v", err)
+			}
+		}
+	}
+}
+
+func TestTieBreakChooserDropsConnectionThePeerGaveUp(t *testing.T) {
+	c := NewClient("")
+	chooser := testAttempts(t, true)
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	// the peer reads the pick but gave up before it could take the connection
+	go func() {
+		greet(remote)
+		remote.Write(append([]byte(helloMagic), testSessionID...))
+		io.ReadFull(remote, make([]byte, 1))
+		remote.Close()
+	}()
+	if c.tieBreak(chooser, local, false) {
+		t.Fatalf("expected the chooser to drop the connection")
+	}
+	if !chooser.claim() {
+		t.Fatalf("expected another connection to be pickable")
+	}
+}
+
+func TestTieBreakPeerDropsConnectionTheChooserGaveUp(t *testing.T) {
+	c := NewClient("")
+	other := testAttempts(t, false)
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	// the chooser sent its hello and went away before picking
+	go func() {
+		greet(remote)
+		remote.Write(append([]byte(helloMagic), testSessionID...))
+		remote.Close()
+	}()
+	if c.tieBreak(other, local, false) {
+		t.Fatalf("expected the connection to be dropped")
+	}
+}
@@ -60,8 +60,86 @@ func (rcv *Peer) RemoteAddr(obj *Addr) *Addr {
 	return nil
 }
 
+func (rcv *Peer) IdentityKey(j int) byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(10))
+	if o != 0 {
+		a := rcv._tab.Vector(o)
+		return rcv._tab.GetByte(a + flatbuffers.UOffsetT(j*1))
+	}
+	return 0
+}
+
+func (rcv *Peer) IdentityKeyLength() int {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(10))
+	if o != 0 {
+		return rcv._tab.VectorLen(o)
+	}
+	return 0
+}
+
+func (rcv *Peer) IdentityKeyBytes() []byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(10))
+	if o != 0 {
+		return rcv._tab.ByteVector(o + rcv._tab.Pos)
+	}
+	return nil
+}
+
+func (rcv *Peer) MutateIdentityKey(j int, n byte) bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(10))
+	if o != 0 {
+		a := rcv._tab.Vector(o)
+		return rcv._tab.MutateByte(a+flatbuffers.UOffsetT(j*1), n)
+	}
+	return false
+}
+
+func (rcv *Peer) Candidates(obj *Candidate, j int) bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(12))
+	if o != 0 {
+		x := rcv._tab.Vector(o)
+		x += flatbuffers.UOffsetT(j) * 4
+		x = rcv._tab.Indirect(x)
+		obj.Init(rcv._tab.Bytes, x)
+		return true
+	}
+	return false
+}
+
+func (rcv *Peer) CandidatesLength() int {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(12))
+	if o != 0 {
+		return rcv._tab.VectorLen(o)
+	}
+	return 0
+}
+
+func (rcv *Peer) NatType() NATType {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(14))
+	if o != 0 {
+		return NATType(rcv._tab.GetInt8(o + rcv._tab.Pos))
+	}
+	return 0
+}
+
+func (rcv *Peer) MutateNatType(n NATType) bool {
+	return rcv._tab.MutateInt8Slot(14, int8(n))
+}
+
+func (rcv *Peer) PortDelta() int32 {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(16))
+	if o != 0 {
+		return rcv._tab.GetInt32(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *Peer) MutatePortDelta(n int32) bool {
+	return rcv._tab.MutateInt32Slot(16, n)
+}
+
 func PeerStart(builder *flatbuffers.Builder) {
-	builder.StartObject(3)
+	builder.StartObject(7)
 }
 func PeerAddName(builder *flatbuffers.Builder, name flatbuffers.UOffsetT) {
 	builder.PrependUOffsetTSlot(0, flatbuffers.UOffsetT(name), 0)
@@ -72,6 +150,24 @@ func PeerAddLocalAddr(builder *flatbuffers.Builder, localAddr flatbuffers.UOffse
 func PeerAddRemoteAddr(builder *flatbuffers.Builder, remoteAddr flatbuffers.UOffsetT) {
 	builder.PrependUOffsetTSlot(2, flatbuffers.UOffsetT(remoteAddr), 0)
 }
+func PeerAddIdentityKey(builder *flatbuffers.Builder, identityKey flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(3, flatbuffers.UOffsetT(identityKey), 0)
+}
+func PeerStartIdentityKeyVector(builder *flatbuffers.Builder, numElems int) flatbuffers.UOffsetT {
+	return builder.StartVector(1, numElems, 1)
+}
+func PeerAddCandidates(builder *flatbuffers.Builder, candidates flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(4, flatbuffers.UOffsetT(candidates), 0)
+}
+func PeerStartCandidatesVector(builder *flatbuffers.Builder, numElems int) flatbuffers.UOffsetT {
+	return builder.StartVector(4, numElems, 4)
+}
+func PeerAddNatType(builder *flatbuffers.Builder, natType NATType) {
+	builder.PrependInt8Slot(5, int8(natType), 0)
+}
+func PeerAddPortDelta(builder *flatbuffers.Builder, portDelta int32) {
+	builder.PrependInt32Slot(6, portDelta, 0)
+}
 func PeerEnd(builder *flatbuffers.Builder) flatbuffers.UOffsetT {
 	return builder.EndObject()
 }
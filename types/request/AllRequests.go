@@ -10,18 +10,39 @@ const (
 	AllRequestsNONE                AllRequests = 0
 	AllRequestsRegistrationRequest AllRequests = 1
 	AllRequestsConnectionRequest   AllRequests = 2
+	AllRequestsBindingRequest      AllRequests = 3
+	AllRequestsRelayRequest        AllRequests = 4
+	AllRequestsSyncRequest         AllRequests = 5
+	AllRequestsPing                AllRequests = 6
+	AllRequestsListPeersRequest    AllRequests = 7
+	AllRequestsSubscribeRequest    AllRequests = 8
+	AllRequestsOfferReply          AllRequests = 9
 )
 
 var EnumNamesAllRequests = map[AllRequests]string{
 	AllRequestsNONE:                "NONE",
 	AllRequestsRegistrationRequest: "RegistrationRequest",
 	AllRequestsConnectionRequest:   "ConnectionRequest",
+	AllRequestsBindingRequest:      "BindingRequest",
+	AllRequestsRelayRequest:        "RelayRequest",
+	AllRequestsSyncRequest:         "SyncRequest",
+	AllRequestsPing:                "Ping",
+	AllRequestsListPeersRequest:    "ListPeersRequest",
+	AllRequestsSubscribeRequest:    "SubscribeRequest",
+	AllRequestsOfferReply:          "OfferReply",
 }
 
 var EnumValuesAllRequests = map[string]AllRequests{
 	"NONE":                AllRequestsNONE,
 	"RegistrationRequest": AllRequestsRegistrationRequest,
 	"ConnectionRequest":   AllRequestsConnectionRequest,
+	"BindingRequest":      AllRequestsBindingRequest,
+	"RelayRequest":        AllRequestsRelayRequest,
+	"SyncRequest":         AllRequestsSyncRequest,
+	"Ping":                AllRequestsPing,
+	"ListPeersRequest":    AllRequestsListPeersRequest,
+	"SubscribeRequest":    AllRequestsSubscribeRequest,
+	"OfferReply":          AllRequestsOfferReply,
 }
 
 func (v AllRequests) String() string {
@@ -42,8 +42,20 @@ func (rcv *ConnectionRequest) Requester() []byte {
 	return nil
 }
 
+func (rcv *ConnectionRequest) RequestId() uint32 {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(8))
+	if o != 0 {
+		return rcv._tab.GetUint32(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *ConnectionRequest) MutateRequestId(n uint32) bool {
+	return rcv._tab.MutateUint32Slot(8, n)
+}
+
 func ConnectionRequestStart(builder *flatbuffers.Builder) {
-	builder.StartObject(2)
+	builder.StartObject(3)
 }
 func ConnectionRequestAddPeer(builder *flatbuffers.Builder, peer flatbuffers.UOffsetT) {
 	builder.PrependUOffsetTSlot(0, flatbuffers.UOffsetT(peer), 0)
@@ -51,6 +63,9 @@ func ConnectionRequestAddPeer(builder *flatbuffers.Builder, peer flatbuffers.UOf
 func ConnectionRequestAddRequester(builder *flatbuffers.Builder, requester flatbuffers.UOffsetT) {
 	builder.PrependUOffsetTSlot(1, flatbuffers.UOffsetT(requester), 0)
 }
+func ConnectionRequestAddRequestId(builder *flatbuffers.Builder, requestId uint32) {
+	builder.PrependUint32Slot(2, requestId, 0)
+}
 func ConnectionRequestEnd(builder *flatbuffers.Builder) flatbuffers.UOffsetT {
 	return builder.EndObject()
 }
@@ -47,8 +47,143 @@ func (rcv *RegistrationRequest) LocalAddr(obj *Addr) *Addr {
 	return nil
 }
 
+func (rcv *RegistrationRequest) SessionToken() []byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(8))
+	if o != 0 {
+		return rcv._tab.ByteVector(o + rcv._tab.Pos)
+	}
+	return nil
+}
+
+func (rcv *RegistrationRequest) Credential(obj *Credential) *Credential {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(10))
+	if o != 0 {
+		x := rcv._tab.Indirect(o + rcv._tab.Pos)
+		if obj == nil {
+			obj = new(Credential)
+		}
+		obj.Init(rcv._tab.Bytes, x)
+		return obj
+	}
+	return nil
+}
+
+func (rcv *RegistrationRequest) IdentityKey(j int) byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(12))
+	if o != 0 {
+		a := rcv._tab.Vector(o)
+		return rcv._tab.GetByte(a + flatbuffers.UOffsetT(j*1))
+	}
+	return 0
+}
+
+func (rcv *RegistrationRequest) IdentityKeyLength() int {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(12))
+	if o != 0 {
+		return rcv._tab.VectorLen(o)
+	}
+	return 0
+}
+
+func (rcv *RegistrationRequest) IdentityKeyBytes() []byte {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(12))
+	if o != 0 {
+		return rcv._tab.ByteVector(o + rcv._tab.Pos)
+	}
+	return nil
+}
+
+func (rcv *RegistrationRequest) MutateIdentityKey(j int, n byte) bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(12))
+	if o != 0 {
+		a := rcv._tab.Vector(o)
+		return rcv._tab.MutateByte(a+flatbuffers.UOffsetT(j*1), n)
+	}
+	return false
+}
+
+func (rcv *RegistrationRequest) Candidates(obj *Candidate, j int) bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(14))
+	if o != 0 {
+		x := rcv._tab.Vector(o)
+		x += flatbuffers.UOffsetT(j) * 4
+		x = rcv._tab.Indirect(x)
+		obj.Init(rcv._tab.Bytes, x)
+		return true
+	}
+	return false
+}
+
+func (rcv *RegistrationRequest) CandidatesLength() int {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(14))
+	if o != 0 {
+		return rcv._tab.VectorLen(o)
+	}
+	return 0
+}
+
+func (rcv *RegistrationRequest) NatType() NATType {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(16))
+	if o != 0 {
+		return NATType(rcv._tab.GetInt8(o + rcv._tab.Pos))
+	}
+	return 0
+}
+
+func (rcv *RegistrationRequest) MutateNatType(n NATType) bool {
+	return rcv._tab.MutateInt8Slot(16, int8(n))
+}
+
+func (rcv *RegistrationRequest) PortDelta() int32 {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(18))
+	if o != 0 {
+		return rcv._tab.GetInt32(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *RegistrationRequest) MutatePortDelta(n int32) bool {
+	return rcv._tab.MutateInt32Slot(18, n)
+}
+
+func (rcv *RegistrationRequest) Hidden() bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(20))
+	if o != 0 {
+		return rcv._tab.GetBool(o + rcv._tab.Pos)
+	}
+	return false
+}
+
+func (rcv *RegistrationRequest) MutateHidden(n bool) bool {
+	return rcv._tab.MutateBoolSlot(20, n)
+}
+
+func (rcv *RegistrationRequest) Offers() bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(22))
+	if o != 0 {
+		return rcv._tab.GetBool(o + rcv._tab.Pos)
+	}
+	return false
+}
+
+func (rcv *RegistrationRequest) MutateOffers(n bool) bool {
+	return rcv._tab.MutateBoolSlot(22, n)
+}
+
+func (rcv *RegistrationRequest) Observer() bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(24))
+	if o != 0 {
+		return rcv._tab.GetBool(o + rcv._tab.Pos)
+	}
+	return false
+}
+
+func (rcv *RegistrationRequest) MutateObserver(n bool) bool {
+	return rcv._tab.MutateBoolSlot(24, n)
+}
+
 func RegistrationRequestStart(builder *flatbuffers.Builder) {
-	builder.StartObject(2)
+	builder.StartObject(11)
 }
 func RegistrationRequestAddName(builder *flatbuffers.Builder, name flatbuffers.UOffsetT) {
 	builder.PrependUOffsetTSlot(0, flatbuffers.UOffsetT(name), 0)
@@ -56,6 +191,39 @@ func RegistrationRequestAddName(builder *flatbuffers.Builder, name flatbuffers.U
 func RegistrationRequestAddLocalAddr(builder *flatbuffers.Builder, localAddr flatbuffers.UOffsetT) {
 	builder.PrependUOffsetTSlot(1, flatbuffers.UOffsetT(localAddr), 0)
 }
+func RegistrationRequestAddSessionToken(builder *flatbuffers.Builder, sessionToken flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(2, flatbuffers.UOffsetT(sessionToken), 0)
+}
+func RegistrationRequestAddCredential(builder *flatbuffers.Builder, credential flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(3, flatbuffers.UOffsetT(credential), 0)
+}
+func RegistrationRequestAddIdentityKey(builder *flatbuffers.Builder, identityKey flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(4, flatbuffers.UOffsetT(identityKey), 0)
+}
+func RegistrationRequestStartIdentityKeyVector(builder *flatbuffers.Builder, numElems int) flatbuffers.UOffsetT {
+	return builder.StartVector(1, numElems, 1)
+}
+func RegistrationRequestAddCandidates(builder *flatbuffers.Builder, candidates flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(5, flatbuffers.UOffsetT(candidates), 0)
+}
+func RegistrationRequestStartCandidatesVector(builder *flatbuffers.Builder, numElems int) flatbuffers.UOffsetT {
+	return builder.StartVector(4, numElems, 4)
+}
+func RegistrationRequestAddNatType(builder *flatbuffers.Builder, natType NATType) {
+	builder.PrependInt8Slot(6, int8(natType), 0)
+}
+func RegistrationRequestAddPortDelta(builder *flatbuffers.Builder, portDelta int32) {
+	builder.PrependInt32Slot(7, portDelta, 0)
+}
+func RegistrationRequestAddHidden(builder *flatbuffers.Builder, hidden bool) {
+	builder.PrependBoolSlot(8, hidden, false)
+}
+func RegistrationRequestAddOffers(builder *flatbuffers.Builder, offers bool) {
+	builder.PrependBoolSlot(9, offers, false)
+}
+func RegistrationRequestAddObserver(builder *flatbuffers.Builder, observer bool) {
+	builder.PrependBoolSlot(10, observer, false)
+}
 func RegistrationRequestEnd(builder *flatbuffers.Builder) flatbuffers.UOffsetT {
 	return builder.EndObject()
 }
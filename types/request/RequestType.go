@@ -9,16 +9,37 @@ type RequestType int8
 const (
 	RequestTypeRegistration RequestType = 0
 	RequestTypeConnection   RequestType = 1
+	RequestTypeBinding      RequestType = 2
+	RequestTypeRelay        RequestType = 3
+	RequestTypeSync         RequestType = 4
+	RequestTypePing         RequestType = 5
+	RequestTypeListPeers    RequestType = 6
+	RequestTypeSubscribe    RequestType = 7
+	RequestTypeOfferReply   RequestType = 8
 )
 
 var EnumNamesRequestType = map[RequestType]string{
 	RequestTypeRegistration: "Registration",
 	RequestTypeConnection:   "Connection",
+	RequestTypeBinding:      "Binding",
+	RequestTypeRelay:        "Relay",
+	RequestTypeSync:         "Sync",
+	RequestTypePing:         "Ping",
+	RequestTypeListPeers:    "ListPeers",
+	RequestTypeSubscribe:    "Subscribe",
+	RequestTypeOfferReply:   "OfferReply",
 }
 
 var EnumValuesRequestType = map[string]RequestType{
 	"Registration": RequestTypeRegistration,
 	"Connection":   RequestTypeConnection,
+	"Binding":      RequestTypeBinding,
+	"Relay":        RequestTypeRelay,
+	"Sync":         RequestTypeSync,
+	"Ping":         RequestTypePing,
+	"ListPeers":    RequestTypeListPeers,
+	"Subscribe":    RequestTypeSubscribe,
+	"OfferReply":   RequestTypeOfferReply,
 }
 
 func (v RequestType) String() string {